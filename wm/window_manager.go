@@ -3,18 +3,26 @@ package wm
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"math"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
 	"github.com/jezek/xgb"
 	"github.com/jezek/xgb/randr"
 	"github.com/jezek/xgb/xproto"
@@ -29,19 +37,36 @@ var XUtil *xgbutil.XUtil
 // Config represents the application configuration.
 // tiling window gaps, unfocused/focused window border colors, mod key for all wm actions, window border width, keybinds
 type Config struct {
-	lyts           map[int][]Layout
-	Layouts        []map[int][]Layout `yaml:"layouts"`
-	Gap            uint32             `yaml:"gaps"`
-	Resize         uint32             `yaml:"resize-amount"`
-	OuterGap       uint32             `yaml:"outer-gap"`
-	StartTiling    bool               `yaml:"default-tiling"`
-	BorderUnactive uint32             `yaml:"unactive-border-color"`
-	BorderActive   uint32             `yaml:"active-border-color"`
-	ModKey         string             `yaml:"mod-key"`
-	BorderWidth    uint32             `yaml:"border-width"`
-	Keybinds       []Keybind          `yaml:"keybinds"`
-	AutoFullscreen bool               `yaml:"auto-fullscreen"`
-	Monitors       []MonitorConfig    `yaml:"monitors"`
+	lyts            map[int][]Layout
+	Layouts         []map[int][]Layout `yaml:"layouts"`
+	Gap             uint32             `yaml:"gaps"`
+	Resize          uint32             `yaml:"resize-amount"`
+	OuterGap        uint32             `yaml:"outer-gap"`
+	StartTiling     bool               `yaml:"default-tiling"`
+	BorderUnactive  uint32             `yaml:"unactive-border-color"`
+	BorderActive    uint32             `yaml:"active-border-color"`
+	BorderUrgent    uint32             `yaml:"urgent-border-color"`
+	ModKey          string             `yaml:"mod-key"`
+	BorderWidth     uint32             `yaml:"border-width"`
+	Keybinds        []Keybind          `yaml:"keybinds"`
+	AutoFullscreen  bool               `yaml:"auto-fullscreen"`
+	Monitors        []MonitorConfig    `yaml:"monitors"`
+	Mousebinds      []Mousebind        `yaml:"mousebinds"`
+	FocusOnActivate string             `yaml:"focus-on-activate"`
+	FocusMode       string             `yaml:"focus-mode"`
+	WarpPointer     string             `yaml:"warp-pointer"`
+	ChordTimeout    int                `yaml:"chord-timeout"`
+	RestoreMenu     string             `yaml:"restore-menu"`
+	Modes           []Mode             `yaml:"modes"`
+	WorkspaceKeys   []string           `yaml:"workspace-keys"`
+	ReloadErrorExec string             `yaml:"reload-error-exec"`
+}
+
+// Mode is a named set of keybinds that replaces the normal ones while it is active, they are pressed without the mod
+// key. Escape always goes back to the normal keybinds.
+type Mode struct {
+	Name     string    `yaml:"name"`
+	Keybinds []Keybind `yaml:"keybinds"`
 }
 
 // MonitorConfig is the position of monitors defined in the user config
@@ -51,13 +76,45 @@ type MonitorConfig struct {
 }
 
 // Keybind represents a keybind: keycode, the letter of the key, if shift should be pressed,
-// command (can be empty), role in wm (can be empty).
+// command (can be empty), role in wm (can be empty), binding mode to switch to (can be empty).
 type Keybind struct {
-	Keycode uint32
+	Keycode uint32 `yaml:"-"`
 	Key     string `yaml:"key"`
 	Shift   bool   `yaml:"shift"`
 	Exec    string `yaml:"exec"`
 	Role    string `yaml:"role"`
+	Mode    string `yaml:"mode"`
+	// settings for the role, like how far to move or which workspace to go to
+	Args map[string]int `yaml:"args"`
+	// extra modifiers, setting these (or writing the key like "ctrl+alt+t") means the mod key and shift aren't added
+	// for you
+	Mods      []string `yaml:"mods"`
+	Modifiers uint16   `yaml:"-"`
+	// the rest of a sequence like "mod+a, t", the keybind above is the prefix that starts it
+	Then []Chord `yaml:"-"`
+	// "release" runs the keybind when the key is let go instead of when it is pressed
+	On string `yaml:"on"`
+	// don't run again while the key is held down and repeating
+	NoRepeat bool `yaml:"no-repeat"`
+}
+
+// Mousebind is a mouse button (with modifiers) that runs a command or a role, the "move" and "resize" roles drag the
+// window that was clicked. Root mousebinds only work when clicking on the desktop and don't need the mod key.
+type Mousebind struct {
+	Button    string         `yaml:"button"`
+	Mods      []string       `yaml:"mods"`
+	Root      bool           `yaml:"root"`
+	Exec      string         `yaml:"exec"`
+	Role      string         `yaml:"role"`
+	Args      map[string]int `yaml:"args"`
+	Detail    xproto.Button  `yaml:"-"`
+	Modifiers uint16         `yaml:"-"`
+}
+
+// Chord is one step of a keybind sequence.
+type Chord struct {
+	Keycode   uint32
+	Modifiers uint16
 }
 
 // LayoutWindow represents where a window is on a layout (dynamic by using percentages).
@@ -83,15 +140,41 @@ type ResizeLayout struct {
 	Windows []RLayoutWindow
 }
 
+// ICCCM WM_STATE values.
+const (
+	wmStateNormal = 1
+	wmStateIconic = 3
+)
+
 // Window represents a basic window struct.
 type Window struct {
 	id            xproto.Window
 	X, Y          int
 	Width, Height int
 	Fullscreen    bool
+	Minimized     bool
+	Above         bool
+	Below         bool
+	Sticky        bool
+	Shaded        bool
+	Urgent        bool
+	NoInput       bool // WM_HINTS says the window doesn't want keyboard input from us
+	TakeFocus     bool // the window wants WM_TAKE_FOCUS messages
+	Title         string
+	Class         string // the class and instance names from WM_CLASS
+	Instance      string
+	SizeHints     SizeHints
 	Client        xproto.Window
 }
 
+// SizeHints are the size constraints from a window's WM_NORMAL_HINTS, zero means not set.
+type SizeHints struct {
+	MinWidth, MinHeight   int
+	MaxWidth, MaxHeight   int
+	BaseWidth, BaseHeight int
+	WidthInc, HeightInc   int
+}
+
 // Space represents an area on the screen.
 type Space struct {
 	X, Y          int
@@ -105,6 +188,7 @@ type Workspace struct {
 	layoutIndex   int
 	detachTiling  bool
 	windowList    []*Window
+	minimized     []*Window
 	resized       bool
 	resizedLayout ResizeLayout
 }
@@ -125,6 +209,17 @@ type Monitor struct {
 	crtc           randr.Crtc
 }
 
+// moveResize is an interactive move or resize asked for by a client with _NET_WM_MOVERESIZE, it keeps where the
+// pointer and window started so every motion can be worked out from there.
+type moveResize struct {
+	window         xproto.Window
+	direction      uint32
+	keyboard       bool
+	startX, startY int16
+	offX, offY     int16
+	geom           Space
+}
+
 // WindowManager represents the connection, root window, width and height of screen, workspaces,
 // the current workspace index,the current workspace, atoms for EMWH, if the wm is tiling, the space for tiling
 // windows to be, the different tiling layouts, the wm config, the mod key.
@@ -138,6 +233,39 @@ type WindowManager struct {
 	mod           uint16
 	windows       map[xproto.Window]*Window
 	crtcToMonitor map[randr.Crtc]*Monitor
+	checkWin      xproto.Window
+	moveResize    *moveResize
+	clientOrder   []xproto.Window // managed windows in the order they were mapped
+	stack         []xproto.Window // managed windows from bottom to top (within their layer)
+	docks         []xproto.Window
+	struts        map[xproto.Window]strut // what each dock reserves, read again when it changes
+	focused       xproto.Window
+	focusHistory  []xproto.Window // managed windows from most to least recently focused
+	cycle         *focusCycle
+	// the pointer was left over another window when focus was moved from the keyboard, so enter and leave events are
+	// ignored until it moves away from where it was left
+	pointerLeftBehind        bool
+	leftBehindX, leftBehindY int16
+	// the server time of the last event from the user, WM_TAKE_FOCUS has to carry a real timestamp
+	lastTime xproto.Timestamp
+	// the active binding mode and its keybinds, empty for the normal keybinds
+	mode         string
+	modeKeybinds []Keybind
+	numlock      uint16
+	// keybind sequences whose prefix has been pressed and are waiting for their next key
+	chord       *pendingChord
+	chordSerial uint32
+	// release keybinds whose key is held down, run when it is let go
+	armed []Keybind
+	// an event read early while checking for key repeat, handled before waiting for the next one
+	peeked xgb.Event
+	// the key whose next press is only the key repeating
+	repeatKey xproto.Keycode
+	// key presses made up to run keybinds that weren't pressed, and the keybinds of the one being handled
+	pressQueue  []queuedPress
+	queuedBinds []Keybind
+	// functions to call when a property changes on a client, keyed by the property atom
+	propertyHandlers []propertyHandler
 }
 
 func (wm *WindowManager) cursor() { //nolint:unused
@@ -259,34 +387,56 @@ func createLayouts() map[int][]Layout {
 	}
 }
 
-// read and create config, if certain values, aren't provided, use the default values.
-func createConfig() Config {
+// defaultChordTimeout is how many milliseconds a keybind sequence waits for its next key if the config doesn't say.
+const defaultChordTimeout = 2000
+
+// read and create config, if certain values, aren't provided, use the default values. When the file has problems but
+// could still be loaded the error is configWarnings listing all of them, any other error means the file couldn't be
+// read or parsed.
+func createConfig() (Config, error) {
 	// Set defaults manually
 	cfg := Config{
-		Gap:            6,
-		OuterGap:       0,
-		BorderWidth:    3,
-		ModKey:         "Mod1",
-		BorderUnactive: 0x8bd5ca,
-		BorderActive:   0xa6da95,
-		Keybinds:       []Keybind{},
-		lyts:           createLayouts(),
-		Layouts:        []map[int][]Layout{},
-		StartTiling:    false,
-		AutoFullscreen: false,
-		Monitors:       []MonitorConfig{},
+		Gap:             6,
+		OuterGap:        0,
+		BorderWidth:     3,
+		ModKey:          "Mod1",
+		BorderUnactive:  0x8bd5ca,
+		BorderActive:    0xa6da95,
+		BorderUrgent:    0xed8796,
+		Keybinds:        []Keybind{},
+		lyts:            createLayouts(),
+		Layouts:         []map[int][]Layout{},
+		StartTiling:     false,
+		AutoFullscreen:  false,
+		Monitors:        []MonitorConfig{},
+		FocusOnActivate: "smart",
+		FocusMode:       "follow",
+		WarpPointer:     "always",
+		ChordTimeout:    defaultChordTimeout,
+		RestoreMenu:     "rofi -dmenu -i -p restore",
+		WorkspaceKeys:   []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "0"},
+		ReloadErrorExec: `notify-send "doWM config problems"`,
+		Mousebinds: []Mousebind{
+			{Button: "left", Role: "move"},
+			{Button: "right", Role: "resize"},
+		},
 	}
 
 	home, _ := os.UserHomeDir()
-	f, err := os.ReadFile(filepath.Join(home, ".config", "doWM", "doWM.yml"))
+	path := filepath.Join(home, ".config", "doWM", "doWM.yml")
+	f, err := os.ReadFile(path)
 	if err != nil {
-		slog.Error("Couldn't read doWM.yml config file", "error:", err)
-		return cfg
+		return cfg, fmt.Errorf("couldn't read config file: %w", err)
 	}
 
 	if err := yaml.Unmarshal(f, &cfg); err != nil {
-		slog.Error("Couldn't parse doWM.yml config file", "error:", err)
-		return cfg
+		checker := configChecker{path: path}
+		checker.yamlError(err)
+		return cfg, checker.err()
+	}
+	var warnings error
+	if err := validateConfig(path, f, &cfg); err != nil {
+		warnings = configWarnings{err}
 	}
 
 	if len(cfg.Layouts) > 0 {
@@ -301,7 +451,317 @@ func createConfig() Config {
 		cfg.lyts = lyts
 	}
 
-	return cfg
+	return cfg, warnings
+}
+
+// configWarnings are problems in a config file that could still be loaded, the settings with problems just won't do
+// anything (or keep their defaults). Any other error from createConfig means the file couldn't be used at all.
+type configWarnings struct {
+	error
+}
+
+// roles are all of the keybind roles, the key press handling in Run has what they do.
+var roles = map[string]bool{
+	"resize-x-scale-up": true, "resize-x-scale-down": true, "resize-y-scale-up": true, "resize-y-scale-down": true,
+	"move-x-right": true, "move-x-left": true, "move-y-up": true, "move-y-down": true,
+	"move-by": true, "resize-by": true, "workspace": true, "move-to-workspace": true,
+	"quit": true, "force-quit": true, "toggle-tiling": true, "detach-tiling": true, "toggle-fullscreen": true,
+	"minimize": true, "restore-last": true, "restore-menu": true, "focus-urgent": true, "focus-last": true,
+	"cycle-focus-next": true, "cycle-focus-prev": true, "next-workspace": true, "prev-workspace": true,
+	"focus-left": true, "focus-right": true, "focus-up": true, "focus-down": true,
+	"swap-left": true, "swap-right": true, "swap-up": true, "swap-down": true,
+	"move-left": true, "move-right": true, "move-up": true, "move-down": true,
+	"swap-window-left": true, "swap-window-right": true, "focus-window-left": true, "focus-window-right": true,
+	"reload-config": true, "next-layout": true, "increase-gap": true, "decrease-gap": true,
+}
+
+// roleArgs are the args each role takes, roles that aren't here don't take any.
+var roleArgs = map[string][]string{
+	"resize-x-scale-up": {"amount"}, "resize-x-scale-down": {"amount"},
+	"resize-y-scale-up": {"amount"}, "resize-y-scale-down": {"amount"},
+	"move-x-right": {"amount"}, "move-x-left": {"amount"}, "move-y-up": {"amount"}, "move-y-down": {"amount"},
+	"increase-gap": {"amount"}, "decrease-gap": {"amount"},
+	"move-by": {"dx", "dy"}, "resize-by": {"dw", "dh"},
+	"workspace": {"index"}, "move-to-workspace": {"index"},
+}
+
+// configProblem is something wrong in the config file and the line it is on (0 if it isn't known).
+type configProblem struct {
+	line int
+	msg  string
+}
+
+// configChecker collects the problems in a config file, places in the file are given as yaml paths like
+// "$.keybinds[2].role" which are looked up to find the line.
+type configChecker struct {
+	path     string
+	file     *ast.File
+	problems []configProblem
+}
+
+func (c *configChecker) errorf(at string, format string, args ...any) {
+	line := 0
+	if p, err := yaml.PathString(at); err == nil && c.file != nil {
+		if node, err := p.FilterFile(c.file); err == nil && node != nil {
+			line = node.GetToken().Position.Line
+		}
+	}
+	c.problems = append(c.problems, configProblem{line: line, msg: fmt.Sprintf(format, args...)})
+}
+
+// yamlError adds an error from the yaml decoder, which knows where it happened itself.
+func (c *configChecker) yamlError(err error) {
+	var yamlErr yaml.Error
+	if errors.As(err, &yamlErr) && yamlErr.GetToken() != nil {
+		c.problems = append(c.problems, configProblem{line: yamlErr.GetToken().Position.Line, msg: yamlErr.GetMessage()})
+		return
+	}
+	c.problems = append(c.problems, configProblem{msg: err.Error()})
+}
+
+// err puts the problems in order as "file:line: problem", one per line, or is nil if there weren't any.
+func (c *configChecker) err() error {
+	slices.SortStableFunc(c.problems, func(a, b configProblem) int { return a.line - b.line })
+	errs := make([]error, 0, len(c.problems))
+	for _, problem := range c.problems {
+		if problem.line == 0 {
+			errs = append(errs, fmt.Errorf("%s: %s", c.path, problem.msg))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s:%d: %s", c.path, problem.line, problem.msg))
+	}
+	return errors.Join(errs...)
+}
+
+// validateConfig looks for settings that parse fine but can't work, like unknown roles or keys and layouts that don't
+// fit on the screen.
+func validateConfig(path string, src []byte, cfg *Config) error {
+	file, err := parser.ParseBytes(src, 0)
+	if err != nil {
+		return err
+	}
+	c := configChecker{path: path, file: file}
+
+	for _, doc := range file.Docs {
+		c.unknownKeys(doc, reflect.TypeFor[Config]())
+	}
+
+	// a bad value goes back to the default, which is the first allowed one
+	c.oneOf("$.mod-key", "mod-key", &cfg.ModKey, "Mod1", "Mod2", "Mod3", "Mod4", "Mod5")
+	c.oneOf("$.focus-mode", "focus-mode", &cfg.FocusMode, "follow", "sloppy", "click")
+	c.oneOf("$.warp-pointer", "warp-pointer", &cfg.WarpPointer, "always", "on-monitor-change", "never")
+	c.oneOf("$.focus-on-activate", "focus-on-activate", &cfg.FocusOnActivate, "smart", "focus", "urgent", "none")
+	if cfg.ChordTimeout <= 0 {
+		c.errorf("$.chord-timeout", "chord-timeout is %d, it has to be more than 0 milliseconds", cfg.ChordTimeout)
+		cfg.ChordTimeout = defaultChordTimeout
+	}
+
+	for i, kb := range cfg.Keybinds {
+		c.checkKeybind(fmt.Sprintf("$.keybinds[%d]", i), kb, cfg.Modes)
+	}
+	for i, mode := range cfg.Modes {
+		if mode.Name == "" || mode.Name == "default" {
+			c.errorf(fmt.Sprintf("$.modes[%d]", i), "a binding mode needs a name other than \"default\"")
+		}
+		for j, kb := range mode.Keybinds {
+			c.checkKeybind(fmt.Sprintf("$.modes[%d].keybinds[%d]", i, j), kb, cfg.Modes)
+		}
+	}
+	for i, mb := range cfg.Mousebinds {
+		at := fmt.Sprintf("$.mousebinds[%d]", i)
+		parts := strings.Split(mb.Button, "+")
+		name := strings.ToLower(strings.TrimSpace(parts[len(parts)-1]))
+		if _, ok := buttonNames[name]; !ok {
+			if n, err := strconv.Atoi(name); err != nil || n < 1 || n > 255 {
+				c.errorf(at+".button", "unknown button %q", name)
+			}
+		}
+		c.checkModifiers(at+".button", parts[:len(parts)-1])
+		c.checkModifiers(at+".mods", mb.Mods)
+		// move and resize drag the window, they aren't the keybind roles
+		if mb.Role == "move" || mb.Role == "resize" {
+			if len(mb.Args) > 0 {
+				c.errorf(at+".args", "dragging doesn't take args, move-by and resize-by are the roles that do")
+			}
+		} else {
+			c.checkRole(at, mb.Role, mb.Args)
+		}
+		if mb.Exec == "" && mb.Role == "" {
+			c.errorf(at, "mousebind has no exec or role")
+		}
+	}
+	for i, key := range cfg.WorkspaceKeys {
+		c.checkKey(fmt.Sprintf("$.workspace-keys[%d]", i), key)
+	}
+	if len(cfg.WorkspaceKeys) > 10 {
+		c.errorf("$.workspace-keys", "there are only 10 workspaces but %d workspace keys", len(cfg.WorkspaceKeys))
+	}
+
+	for i, lyts := range cfg.Layouts {
+		for n, layouts := range lyts {
+			if n < 1 {
+				c.errorf(fmt.Sprintf("$.layouts[%d]", i), "layouts are for 1 or more windows, not %d", n)
+				continue
+			}
+			for j, layout := range layouts {
+				c.checkLayout(fmt.Sprintf("$.layouts[%d].%d[%d]", i, n, j), n, layout)
+			}
+		}
+	}
+	return c.err()
+}
+
+func (c *configChecker) oneOf(at, setting string, value *string, allowed ...string) {
+	if !slices.Contains(allowed, *value) {
+		c.errorf(at, "%s is %q, it can be %s", setting, *value, strings.Join(allowed, ", "))
+		*value = allowed[0]
+	}
+}
+
+// unknownKeys reports every key in the file that isn't a setting, following the types the settings are read into.
+func (c *configChecker) unknownKeys(node ast.Node, t reflect.Type) {
+	switch n := node.(type) {
+	case *ast.DocumentNode:
+		c.unknownKeys(n.Body, t)
+	case *ast.AnchorNode:
+		c.unknownKeys(n.Value, t)
+	case *ast.TagNode:
+		c.unknownKeys(n.Value, t)
+	case *ast.MappingNode:
+		for _, value := range n.Values {
+			c.unknownKeys(value, t)
+		}
+	case *ast.MappingValueNode:
+		switch t.Kind() {
+		case reflect.Map:
+			c.unknownKeys(n.Value, t.Elem())
+		case reflect.Struct:
+			key := n.Key.GetToken()
+			if key.Value == "<<" {
+				return
+			}
+			field, ok := yamlField(t, key.Value)
+			if !ok {
+				c.problems = append(c.problems, configProblem{
+					line: key.Position.Line,
+					msg:  fmt.Sprintf("unknown setting %q", key.Value),
+				})
+				return
+			}
+			c.unknownKeys(n.Value, field.Type)
+		}
+	case *ast.SequenceNode:
+		if t.Kind() == reflect.Slice {
+			for _, value := range n.Values {
+				c.unknownKeys(value, t.Elem())
+			}
+		}
+	}
+}
+
+// yamlField finds the field of a struct that a config key is read into.
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.IsExported() && field.Tag.Get("yaml") == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func (c *configChecker) checkKeybind(at string, kb Keybind, modes []Mode) {
+	for _, chord := range strings.Split(kb.Key, ",") {
+		c.checkKey(at+".key", strings.TrimSpace(chord))
+	}
+	c.checkModifiers(at+".mods", kb.Mods)
+	c.checkRole(at, kb.Role, kb.Args)
+	if kb.Mode != "" && kb.Mode != "default" &&
+		!slices.ContainsFunc(modes, func(m Mode) bool { return m.Name == kb.Mode }) {
+		c.errorf(at+".mode", "there is no binding mode called %q", kb.Mode)
+	}
+	if kb.On != "" && kb.On != "press" && kb.On != "release" {
+		c.errorf(at+".on", "on is %q, it can be press or release", kb.On)
+	}
+	if kb.Exec == "" && kb.Role == "" && kb.Mode == "" {
+		c.errorf(at, "keybind has no exec, role or mode")
+	}
+}
+
+// checkKey checks a key spec like "ctrl+alt+t", the key has to be on the keyboard as it is now.
+func (c *configChecker) checkKey(at, spec string) {
+	parts := strings.Split(spec, "+")
+	key := strings.TrimSpace(parts[len(parts)-1])
+	c.checkModifiers(at, parts[:len(parts)-1])
+	if key == "" {
+		c.errorf(at, "keybind has no key")
+		return
+	}
+	if XUtil != nil && len(keybind.StrToKeycodes(XUtil, key)) == 0 {
+		c.errorf(at, "key %q isn't on the current keyboard layout", key)
+	}
+}
+
+func (c *configChecker) checkModifiers(at string, names []string) {
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := modifierNames[name]; !ok && name != "mod" {
+			c.errorf(at, "unknown modifier %q", name)
+		}
+	}
+}
+
+func (c *configChecker) checkRole(at, role string, args map[string]int) {
+	if role != "" && !roles[role] {
+		c.errorf(at+".role", "unknown role %q", role)
+	}
+	names := slices.Sorted(maps.Keys(args))
+	for _, name := range names {
+		if !slices.Contains(roleArgs[role], name) {
+			c.errorf(at+".args", "%s doesn't take the arg %q", cmp.Or(role, "a keybind without a role"), name)
+		}
+	}
+	if amount, ok := args["amount"]; ok && (amount < 0 || amount > math.MaxUint16) {
+		c.errorf(at+".args", "amount is from 0 to %d", math.MaxUint16)
+	}
+	if role == "workspace" || role == "move-to-workspace" {
+		if index, ok := args["index"]; !ok || index < 1 || index > 10 {
+			c.errorf(at, "%s needs args: {index: n} with n from 1 to 10", role)
+		}
+	}
+}
+
+// checkLayout makes sure a layout has a place for each of its n windows, inside the tiling space and not on top of
+// each other. Percentages are allowed to be a little out, since thirds can't be written exactly.
+func (c *configChecker) checkLayout(at string, n int, layout Layout) {
+	const slack = 0.001
+	if len(layout.Windows) < n {
+		c.errorf(at, "layout for %d windows only has %d", n, len(layout.Windows))
+	}
+	for i, w := range layout.Windows {
+		wat := fmt.Sprintf("%s.windows[%d]", at, i)
+		for _, v := range []float64{w.XPercentage, w.YPercentage, w.WidthPercentage, w.HeightPercentage} {
+			if v < 0 || v > 1 {
+				c.errorf(wat, "x, y, width and height are from 0.0 to 1.0")
+				break
+			}
+		}
+		if w.WidthPercentage <= 0 || w.HeightPercentage <= 0 {
+			c.errorf(wat, "window has no width or height")
+		}
+		if w.XPercentage+w.WidthPercentage > 1+slack || w.YPercentage+w.HeightPercentage > 1+slack {
+			c.errorf(wat, "window goes past the edge of the tiling space")
+		}
+		for j, o := range layout.Windows[:i] {
+			overlapX := min(w.XPercentage+w.WidthPercentage, o.XPercentage+o.WidthPercentage) -
+				max(w.XPercentage, o.XPercentage)
+			overlapY := min(w.YPercentage+w.HeightPercentage, o.YPercentage+o.HeightPercentage) -
+				max(w.YPercentage, o.YPercentage)
+			if overlapX > slack && overlapY > slack {
+				c.errorf(wat, "window overlaps window %d of the layout", j+1)
+			}
+		}
+	}
 }
 
 // Create creates the X connection and get the root window, create workspaces and create window manager struct.
@@ -378,6 +838,7 @@ func Create() (*WindowManager, error) {
 		for i := range workspaces {
 			workspaces[i] = Workspace{
 				windowList:    []*Window{},
+				minimized:     []*Window{},
 				tiling:        false,
 				detachTiling:  false,
 				layoutIndex:   0,
@@ -410,7 +871,10 @@ func Create() (*WindowManager, error) {
 		currMonitor:   &monitors[0],
 		atoms:         map[string]xproto.Atom{},
 		windows:       map[xproto.Window]*Window{},
+		struts:        map[xproto.Window]strut{},
 		crtcToMonitor: crtcToMonitor,
+
+		propertyHandlers: []propertyHandler{},
 	}, nil
 }
 
@@ -472,63 +936,226 @@ func getKeycodeForKeysym(conn *xgb.Conn, keysym uint32) xproto.Keycode {
 	return 0
 }
 
-// gets keycode of key and sets it, then tells the X server to notify us when this keybind is pressed.
-func (wm *WindowManager) createKeybind(kb *Keybind) Keybind {
-	code := keybind.StrToKeycodes(XUtil, kb.Key)
-	if len(code) < 1 {
-		return Keybind{
-			Keycode: 0,
-			Key:     "",
-			Shift:   false,
-			Exec:    "",
+// gets keycode of key and sets it, then tells the X server to notify us when this keybind is pressed with its
+// modifiers (mod is the mod key normally, nothing in a binding mode, unless the keybind sets its own modifiers).
+func (wm *WindowManager) createKeybind(kb *Keybind, mod uint16) Keybind {
+	// only the first key of a sequence is grabbed, the keyboard is grabbed for the rest once it is pressed
+	chords := strings.Split(kb.Key, ",")
+	first := *kb
+	first.Key = strings.TrimSpace(chords[0])
+	// a key that isn't on the keyboard keeps its settings but with no keycode it never matches, so it can be found
+	// again if the keyboard layout changes
+	kb.Keycode = 0
+	kb.Then = nil
+	key, mask, ok := wm.parseKeySpec(&first, mod)
+	if !ok {
+		return *kb
+	}
+	var then []Chord
+	for _, chord := range chords[1:] {
+		k, m, ok := wm.parseKeySpec(&Keybind{Key: strings.TrimSpace(chord)}, 0)
+		codes := keybind.StrToKeycodes(XUtil, k)
+		if !ok || len(codes) < 1 {
+			slog.Error("Couldn't find key in keybind sequence", "key", kb.Key)
+			return *kb
 		}
+		then = append(then, Chord{Keycode: uint32(codes[0]), Modifiers: m})
+	}
+	code := keybind.StrToKeycodes(XUtil, key)
+	if len(code) < 1 {
+		slog.Error("Couldn't find key for keybind", "key", kb.Key)
+		return *kb
 	}
+	kb.Then = then
 	KeyCode := code[0]
 	kb.Keycode = uint32(KeyCode)
-	Mask := wm.mod
-	if kb.Shift {
-		Mask |= xproto.ModMaskShift
-	}
-	err := xproto.GrabKeyChecked(wm.conn, true, wm.root, Mask, KeyCode, xproto.GrabModeAsync, xproto.GrabModeAsync).
-		Check()
-	if err != nil {
-		slog.Error("Couldn't grab key", "error:", err)
-	}
+	kb.Modifiers = mask
 
-	err = xproto.GrabKeyChecked(
-		wm.conn,
-		true,
-		wm.root,
-		Mask|xproto.ModMaskLock,
-		KeyCode,
-		xproto.GrabModeAsync,
-		xproto.GrabModeAsync,
-	).
-		Check()
-	if err != nil {
-		slog.Error("Couldn't grab key", "error:", err)
-	}
-	numlock := getNumLockMask(wm.conn)
-	if numlock != wm.mod {
-		err = xproto.GrabKeyChecked(
+	// the keybind should work whatever caps lock and num lock are doing, so grab it with every combination of them
+	wm.numlock = getNumLockMask(wm.conn)
+	for _, extra := range []uint16{0, xproto.ModMaskLock, wm.numlock, xproto.ModMaskLock | wm.numlock} {
+		err := xproto.GrabKeyChecked(
 			wm.conn,
 			true,
 			wm.root,
-			Mask|numlock,
+			mask|extra,
 			KeyCode,
 			xproto.GrabModeAsync,
 			xproto.GrabModeAsync,
 		).
 			Check()
+		if err != nil {
+			slog.Error("Couldn't grab key", "error:", err)
+		}
+	}
+
+	return *kb
+}
+
+// modifierNames maps what modifiers are called in keybinds to their masks, "mod" is the configured mod key.
+var modifierNames = map[string]uint16{
+	"shift":   xproto.ModMaskShift,
+	"ctrl":    xproto.ModMaskControl,
+	"control": xproto.ModMaskControl,
+	"alt":     xproto.ModMask1,
+	"mod1":    xproto.ModMask1,
+	"mod2":    xproto.ModMask2,
+	"mod3":    xproto.ModMask3,
+	"super":   xproto.ModMask4,
+	"win":     xproto.ModMask4,
+	"mod4":    xproto.ModMask4,
+	"mod5":    xproto.ModMask5,
+}
+
+// parseKeySpec works out the key and modifier mask of a keybind. A plain key gets mod (and shift if it is set), a key
+// written like "super+ctrl+h" or with a mods list gets exactly the modifiers it names, so an empty list gets none.
+func (wm *WindowManager) parseKeySpec(kb *Keybind, mod uint16) (string, uint16, bool) {
+	parts := strings.Split(kb.Key, "+")
+	key := parts[len(parts)-1]
+	names := append(parts[:len(parts)-1:len(parts)-1], kb.Mods...)
+
+	// mods: [] is set but empty, that means no modifiers at all
+	if len(names) == 0 && kb.Mods == nil {
+		if kb.Shift {
+			mod |= xproto.ModMaskShift
+		}
+		return key, mod, true
+	}
+
+	mask, ok := wm.parseModifiers(names)
+	if !ok {
+		slog.Error("Unknown modifier in keybind", "key", kb.Key)
+		return "", 0, false
+	}
+	if kb.Shift {
+		mask |= xproto.ModMaskShift
+	}
+	return key, mask, true
+}
+
+func (wm *WindowManager) parseModifiers(names []string) (uint16, bool) {
+	var mask uint16
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "mod" {
+			mask |= wm.mod
+			continue
+		}
+		m, ok := modifierNames[name]
+		if !ok {
+			return 0, false
+		}
+		mask |= m
+	}
+	return mask, true
+}
+
+// buttonNames are the names mousebinds can use for buttons, numbers work too.
+var buttonNames = map[string]xproto.Button{
+	"left":         xproto.ButtonIndex1,
+	"middle":       xproto.ButtonIndex2,
+	"right":        xproto.ButtonIndex3,
+	"scroll-up":    xproto.ButtonIndex4,
+	"scroll-down":  xproto.ButtonIndex5,
+	"scroll-left":  6,
+	"scroll-right": 7,
+}
+
+// parseButtonSpec works out the button and modifiers of a mousebind the same way as parseKeySpec does for keys,
+// except that desktop mousebinds don't get the mod key unless they ask for it.
+func (wm *WindowManager) parseButtonSpec(mb *Mousebind) (xproto.Button, uint16, bool) {
+	parts := strings.Split(mb.Button, "+")
+	name := strings.ToLower(strings.TrimSpace(parts[len(parts)-1]))
+	names := append(parts[:len(parts)-1:len(parts)-1], mb.Mods...)
+
+	button, ok := buttonNames[name]
+	if !ok {
+		n, err := strconv.Atoi(name)
+		if err != nil || n < 1 || n > 255 {
+			slog.Error("Unknown button in mousebind", "button", mb.Button)
+			return 0, 0, false
+		}
+		button = xproto.Button(n)
+	}
+
+	if len(names) == 0 && mb.Mods == nil {
+		if mb.Root {
+			return button, 0, true
+		}
+		return button, wm.mod, true
+	}
+	mask, ok := wm.parseModifiers(names)
+	if !ok {
+		slog.Error("Unknown modifier in mousebind", "button", mb.Button)
+		return 0, 0, false
+	}
+	return button, mask, true
+}
+
+// grabMousebinds grabs the mousebinds with modifiers on the root window so they work over any window. Desktop
+// mousebinds without modifiers can't be grabbed like that without taking every click away from windows, so for those
+// we just ask for clicks on the root window itself.
+func (wm *WindowManager) grabMousebinds() {
+	xproto.UngrabButton(wm.conn, xproto.ButtonIndexAny, wm.root, xproto.ModMaskAny)
+	rootClicks := false
+	for i := range wm.config.Mousebinds {
+		mb := &wm.config.Mousebinds[i]
+		button, mask, ok := wm.parseButtonSpec(mb)
+		mb.Detail, mb.Modifiers = button, mask
+		if !ok {
+			continue
+		}
+		if mask == 0 {
+			rootClicks = true
+			continue
+		}
+		for _, extra := range []uint16{0, xproto.ModMaskLock, wm.numlock, xproto.ModMaskLock | wm.numlock} {
+			err := xproto.GrabButtonChecked(
+				wm.conn,
+				false,
+				wm.root,
+				uint16(xproto.EventMaskButtonPress|xproto.EventMaskButtonRelease|xproto.EventMaskPointerMotion),
+				xproto.GrabModeAsync,
+				xproto.GrabModeAsync,
+				xproto.WindowNone,
+				xproto.AtomNone,
+				byte(button),
+				mask|extra,
+			).
+				Check()
+			if err != nil {
+				slog.Error("Couldn't grab button", "error:", err.Error())
+			}
+		}
+	}
+
+	mask := uint32(xproto.EventMaskSubstructureNotify | xproto.EventMaskSubstructureRedirect)
+	if rootClicks {
+		mask |= xproto.EventMaskButtonPress
 	}
+	err := xproto.ChangeWindowAttributesChecked(wm.conn, wm.root, xproto.CwEventMask, []uint32{mask}).Check()
 	if err != nil {
-		slog.Error("Couldn't create keybind", "error:", err)
+		slog.Error("Couldn't listen for clicks on the desktop", "error:", err)
 	}
+}
 
-	return *kb
+// findMousebind is the mousebind for a click, desktop mousebinds only count when the click isn't on a window.
+func (wm *WindowManager) findMousebind(ev xproto.ButtonPressEvent) (Mousebind, bool) {
+	state := wm.keybindState(ev.State)
+	for _, mb := range wm.config.Mousebinds {
+		if mb.Detail == ev.Detail && mb.Modifiers == state && (!mb.Root || ev.Child == 0) {
+			return mb, true
+		}
+	}
+	return Mousebind{}, false
+}
+
+// keybindState is the modifier state of a key event as keybinds see it, without caps lock, num lock or mouse buttons.
+func (wm *WindowManager) keybindState(state uint16) uint16 {
+	return state & 0xff &^ (xproto.ModMaskLock | wm.numlock)
 }
 
-func (wm *WindowManager) reload(focused xproto.ButtonPressEvent) {
+func (wm *WindowManager) reload() {
 	// set the mod key for the wm
 	var mMask uint16
 	switch wm.config.ModKey {
@@ -546,11 +1173,22 @@ func (wm *WindowManager) reload(focused xproto.ButtonPressEvent) {
 
 	wm.mod = mMask
 
+	// drop the old grabs, otherwise keys that were removed from the config would still be grabbed
+	xproto.UngrabKey(wm.conn, xproto.GrabAny, wm.root, xproto.ModMaskAny)
+
+	// the mode we were in might not exist any more
+	if wm.mode != "" {
+		wm.mode = ""
+		wm.modeKeybinds = nil
+		wm.broadcastMode()
+	}
+
 	// manage keybinds for keybinds in the config
 	for i, kb := range wm.config.Keybinds {
-		wm.config.Keybinds[i] = wm.createKeybind(&kb)
+		wm.config.Keybinds[i] = wm.createKeybind(&kb, wm.mod)
 	}
 	wm.setKeyBinds()
+	wm.grabMousebinds()
 
 	windowsParent, err := xproto.QueryTree(wm.conn, wm.root).Reply()
 	if err != nil {
@@ -563,10 +1201,19 @@ func (wm *WindowManager) reload(focused xproto.ButtonPressEvent) {
 	for _, window := range windows {
 		if win, ok := wm.windows[window]; ok && !win.Fullscreen {
 			col := wm.config.BorderUnactive
-			if window == focused.Child {
+			if win.Urgent {
+				col = wm.config.BorderUrgent
+			}
+			if window == wm.focused {
 				col = wm.config.BorderActive
 			}
 
+			// the focus mode may have changed
+			xproto.UngrabButton(wm.conn, xproto.ButtonIndexAny, window, xproto.ModMaskAny)
+			if wm.config.FocusMode == "click" && window != wm.focused {
+				wm.grabClickToFocus(window)
+			}
+
 			// Set border width
 			err := xproto.ConfigureWindowChecked(
 				wm.conn,
@@ -704,7 +1351,10 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 	// wm.cursor()
 
 	// retrieve config and set values
-	cfg := createConfig()
+	cfg, err := createConfig()
+	if err != nil {
+		slog.Error("Problems in config", "error:", err)
+	}
 	wm.config = cfg
 	if len(wm.config.Monitors) != 0 {
 		wm.positionMonitors()
@@ -724,6 +1374,49 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 	wm.broadcastWorkspace(0)
 	wm.broadcastWorkspaceCount()
 
+	// create EMWH atoms
+	atoms := []string{
+		"_NET_WM_STATE",
+		"_NET_WM_STATE_FULLSCREEN",
+		"_NET_WM_STATE_ABOVE",
+		"_NET_WM_STATE_BELOW",
+		"_NET_WM_STATE_MAXIMIZED_HORZ",
+		"_NET_WM_STATE_MAXIMIZED_VERT",
+		"_NET_WM_WINDOW_TYPE",
+		"_NET_WM_WINDOW_TYPE_DOCK",
+		"_NET_WM_STRUT_PARTIAL",
+		"_NET_WM_STRUT",
+		"_NET_WORKAREA",
+		"_NET_CURRENT_DESKTOP",
+		"_NET_WM_STATE_HIDDEN",
+		"_NET_WM_STATE_STICKY",
+		"_NET_WM_STATE_SHADED",
+		"_NET_WM_STATE_MODAL",
+		"_NET_WM_STATE_SKIP_TASKBAR",
+		"_NET_WM_STATE_SKIP_PAGER",
+		"_NET_WM_STATE_DEMANDS_ATTENTION",
+		"WM_STATE",
+		"WM_CHANGE_STATE",
+		"UTF8_STRING",
+		"_DOWM_URGENT_WORKSPACES",
+		"WM_PROTOCOLS",
+		"WM_TAKE_FOCUS",
+		"_DOWM_MODE",
+		"_DOWM_CHORD_TIMEOUT",
+		"_DOWM_RESTORE",
+	}
+
+	for _, name := range atoms {
+		a, _ := xproto.InternAtom(wm.conn, false, uint16(len(name)), name).Reply()
+		fmt.Printf("%s = %d\n", name, a.Atom)
+		wm.atoms[name] = a.Atom
+	}
+	wm.declareSupportedAtoms()
+	wm.createSupportingWMCheck()
+	wm.registerPropertyHandlers()
+	wm.setNetDesktopGeometry()
+	wm.broadcastMode()
+
 	// grab the server whilst we manage pre-existing windows
 	err = xproto.GrabServerChecked(
 		wm.conn,
@@ -750,11 +1443,38 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 		return
 	}
 
+	cm := wm.currMonitor
 	for _, window := range TopLevelWindows {
+		if wm.isDock(window) {
+			attr, err := xproto.GetWindowAttributes(wm.conn, window).Reply()
+			if err == nil && attr.MapState == xproto.MapStateViewable {
+				wm.addDock(window)
+			}
+			continue
+		}
 		if !shouldIgnoreWindow(wm.conn, window) {
+			// keep windows on the monitor they were already on
+			if mon := wm.monitorOfWindow(window); mon != nil {
+				wm.currMonitor = mon
+			}
 			wm.frame(window, true)
+			wantsFullscreen := wm.adoptNetWMState(window)
+
+			// put windows back on the workspace they say they were on (e.g. after restarting doWM)
+			if desktop, ok := wm.getWindowDesktop(window); ok {
+				wm.moveWindowToWorkspace(window, desktop)
+			} else {
+				wm.setWindowDesktop(window, uint32(wm.currMonitor.workspaceIndex))
+			}
+			// and fullscreen again if they were before, like onMapRequest only if windows may fullscreen themselves
+			if wantsFullscreen && wm.config.AutoFullscreen {
+				wm.toggleFullScreen(window)
+			}
 		}
 	}
+	wm.currMonitor = cm
+	wm.retile()
+	wm.restack()
 
 	err = xproto.UngrabServerChecked(wm.conn).Check()
 	if err != nil {
@@ -781,76 +1501,23 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 
 	// manage keybinds for keybinds in the config
 	for i, kb := range wm.config.Keybinds {
-		wm.config.Keybinds[i] = wm.createKeybind(&kb)
+		wm.config.Keybinds[i] = wm.createKeybind(&kb, wm.mod)
 	}
 
 	wm.setKeyBinds()
 	fmt.Println(wm.config.Keybinds)
 
-	// Only grab with Mod + left or right click (not plain Button1)
-	err = xproto.GrabButtonChecked(
-		wm.conn,
-		false,
-		wm.root,
-		uint16(xproto.EventMaskButtonPress|xproto.EventMaskButtonRelease|xproto.EventMaskPointerMotion),
-		xproto.GrabModeAsync,
-		xproto.GrabModeAsync,
-		xproto.WindowNone,
-		xproto.AtomNone,
-		xproto.ButtonIndex1,
-		mMask,
-	).
-		Check()
-	if err != nil {
-		slog.Error("Couldn't grab button", "error:", err.Error())
-	}
-
-	err = xproto.GrabButtonChecked(
-		wm.conn,
-		false,
-		wm.root,
-		uint16(xproto.EventMaskButtonPress|xproto.EventMaskButtonRelease|xproto.EventMaskPointerMotion),
-		xproto.GrabModeAsync,
-		xproto.GrabModeAsync,
-		xproto.WindowNone,
-		xproto.AtomNone,
-		xproto.ButtonIndex3,
-		mMask,
-	).
-		Check()
-	if err != nil {
-		slog.Error("Couldn't grab window+c key", "error:", err.Error())
-	}
+	wm.grabMousebinds()
 
 	// for moving and resizing, basically the window that will be moved/resized
 	var start xproto.ButtonPressEvent
 	var attr *xproto.GetGeometryReply
-
-	// create EMWH atoms
-	atoms := []string{
-		"_NET_WM_STATE",
-		"_NET_WM_STATE_FULLSCREEN",
-		"_NET_WM_STATE_ABOVE",
-		"_NET_WM_STATE_BELOW",
-		"_NET_WM_STATE_MAXIMIZED_HORZ",
-		"_NET_WM_STATE_MAXIMIZED_VERT",
-		"_NET_WM_WINDOW_TYPE",
-		"_NET_WM_WINDOW_TYPE_DOCK",
-		"_NET_WM_STRUT_PARTIAL",
-		"_NET_WORKAREA",
-		"_NET_CURRENT_DESKTOP",
-	}
-
-	for _, name := range atoms {
-		a, _ := xproto.InternAtom(wm.conn, false, uint16(len(name)), name).Reply()
-		fmt.Printf("%s = %d\n", name, a.Atom)
-		wm.atoms[name] = a.Atom
-	}
-	wm.declareSupportedAtoms()
+	// the mousebind role doing the dragging, move or resize
+	var drag string
 
 	for {
 		// get next event
-		event, err := wm.conn.WaitForEvent()
+		event, err := wm.nextEvent()
 		if err != nil {
 			slog.Error("Event error", "error:", err.Error())
 			continue
@@ -866,7 +1533,6 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 					pointer.RootY <= mon.Y+int16(mon.Height) {
 					wm.currMonitor = &wm.monitors[i]
 					wm.setNetClientList()
-					wm.setNetWorkArea()
 				}
 			}
 		}
@@ -883,19 +1549,49 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 			fmt.Println("RANDR NOTIFY", ev)
 
 		case xproto.ButtonPressEvent:
-			// set values on current window, used later with moving and resizing
-			if ev.Child != 0 && ev.State&mMask != 0 {
+			wm.lastTime = ev.Time
+			// a click on an unfocused window in click to focus mode, focus it then let the click through to the window
+			if ev.Event != wm.root {
+				if _, ok := wm.windows[ev.Event]; ok {
+					wm.focus(ev.Event)
+					wm.raise(ev.Event)
+				}
+				xproto.AllowEvents(wm.conn, xproto.AllowReplayPointer, ev.Time)
+				break
+			}
+
+			mb, ok := wm.findMousebind(ev)
+			if ok && (mb.Role == "move" || mb.Role == "resize") {
+				// set values on current window, used later with moving and resizing
+				if ev.Child == 0 {
+					break
+				}
 				attr, _ = xproto.GetGeometry(wm.conn, xproto.Drawable(ev.Child)).Reply()
 				start = ev
-				if ev.Detail == xproto.ButtonIndex1 {
-					xproto.ConfigureWindow(
-						wm.conn,
-						ev.Child,
-						xproto.ConfigWindowStackMode,
-						[]uint32{xproto.StackModeAbove},
-					)
+				drag = mb.Role
+				if _, ok := wm.windows[ev.Child]; ok && wm.config.FocusMode == "click" {
+					wm.focus(ev.Child)
+				}
+				if drag == "move" {
+					wm.raise(ev.Child)
 				}
-			} else if ev.State&mMask == 0 {
+			} else if ok {
+				// the role acts on the window that was clicked
+				if _, managed := wm.windows[ev.Child]; managed && ev.Child != wm.focused {
+					wm.focus(ev.Child)
+				}
+				wm.queueKeybinds([]Keybind{{Exec: mb.Exec, Role: mb.Role, Args: mb.Args}}, xproto.KeyPressEvent{
+					Time:   ev.Time,
+					Root:   ev.Root,
+					Event:  ev.Event,
+					Child:  ev.Child,
+					RootX:  ev.RootX,
+					RootY:  ev.RootY,
+					EventX: ev.EventX,
+					EventY: ev.EventY,
+					State:  ev.State,
+				})
+			} else {
 				xproto.AllowEvents(wm.conn, xproto.AllowReplayPointer, xproto.TimeCurrentTime)
 			}
 		case xproto.ButtonReleaseEvent:
@@ -904,35 +1600,41 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 				break
 			}
 
+			// a client side decoration drag finishes when the button is let go
+			if wm.moveResize != nil {
+				wm.endMoveResize(false)
+				break
+			}
+
 			// if we don't have the mouse down, we don't want to move or resize
+			if start.Child == 0 {
+				break
+			}
 
 			var startmon *Monitor
 			var endmon *Monitor
-			for _, mon := range wm.monitors {
+			for i, mon := range wm.monitors {
 				if start.RootX >= mon.X && start.RootX <= mon.X+int16(mon.Width) && start.RootY >= mon.Y && start.RootY <= mon.Y+int16(mon.Height) {
-					startmon = &mon
+					startmon = &wm.monitors[i]
 				}
 				if ev.RootX >= mon.X && ev.RootX <= mon.X+int16(mon.Width) && ev.RootY >= mon.Y && ev.RootY <= mon.Y+int16(mon.Height) {
-					endmon = &mon
+					endmon = &wm.monitors[i]
 				}
 			}
 
-			if startmon != endmon {
-				orx := wm.windows[ev.Child].X - int(startmon.X)
-				ory := wm.windows[ev.Child].Y - int(startmon.Y)
-				wm.currMonitor.CurrWorkspace.windowList = append(wm.currMonitor.CurrWorkspace.windowList, &Window{
-					id:     ev.Child,
-					X:      int(endmon.X) + orx,
-					Y:      int(endmon.Y) + ory,
-					Width:  wm.windows[ev.Child].Width,
-					Height: wm.windows[ev.Child].Height,
-					Client: ev.Child,
-				})
+			if win, ok := wm.windows[ev.Child]; ok && startmon != nil && endmon != nil && startmon != endmon {
+				// move the same window over so everything stored on it comes along
+				win.X = int(endmon.X) + win.X - int(startmon.X)
+				win.Y = int(endmon.Y) + win.Y - int(startmon.Y)
 				remove(&startmon.CurrWorkspace.windowList, ev.Child)
+				endmon.CurrWorkspace.windowList = append(endmon.CurrWorkspace.windowList, win)
 				wm.currMonitor = startmon
 				wm.fitToLayout()
 				wm.currMonitor = endmon
 				wm.fitToLayout()
+				if win.Urgent {
+					wm.broadcastUrgency()
+				}
 			}
 			if wm.currMonitor.tiling {
 				found := false
@@ -958,20 +1660,27 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 				}
 			}
 			start.Child = 0
+			drag = ""
 			xproto.AllowEvents(wm.conn, xproto.AllowReplayPointer, xproto.TimeCurrentTime)
 		case xproto.MotionNotifyEvent:
+			wm.lastTime = ev.Time
 			// if we have the mouse down and we are holding the mod key, and if we are not tiling and the window is not
 			// full screen then do some simple maths to move and resize
+			if wm.moveResize != nil {
+				wm.moveResizeMotion(ev.RootX, ev.RootY)
+				break
+			}
 
 			fmt.Println("X:", ev.RootX, "Y:", ev.RootY)
-			for _, mon := range wm.monitors {
-				if ev.RootX >= mon.X && ev.RootX <= mon.X+int16(mon.Width) && ev.RootY >= mon.Y && ev.RootY <= mon.Y+int16(mon.Height) {
-					wm.currMonitor = &mon
-				}
+			if mon := wm.monitorAt(ev.RootX, ev.RootY); mon != nil {
+				wm.currMonitor = mon
 			}
+			wm.pointerLeftBehind = false
 
-			focusWindow(wm.conn, ev.Child)
-			if start.Child != 0 && ev.State&mMask != 0 {
+			if _, ok := wm.windows[ev.Child]; ok && wm.config.FocusMode != "click" && wm.cycle == nil && ev.Child != wm.focused {
+				wm.focus(ev.Child)
+			}
+			if start.Child != 0 && drag != "" {
 				if wm.windows[start.Child] != nil && wm.windows[start.Child].Fullscreen {
 					break
 				}
@@ -983,7 +1692,7 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 				sizeX := attr.Width
 				fmt.Println("start detail")
 				fmt.Println(start.Detail)
-				if start.Detail == xproto.ButtonIndex3 {
+				if drag == "resize" {
 					if wm.currMonitor.CurrWorkspace.tiling {
 						break
 					}
@@ -1016,6 +1725,7 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 			fmt.Println("ConfigureNotify")
 		case xproto.UnmapNotifyEvent:
 			fmt.Println("unmapping")
+			wm.removeDock(ev.Window)
 			wm.onUnmapNotify(ev)
 		case xproto.DestroyNotifyEvent:
 			fmt.Println("DestroyNotify")
@@ -1023,12 +1733,17 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 			fmt.Println(ev.Window)
 			fmt.Println("Event:")
 			fmt.Println(ev.Event)
+			if wm.moveResize != nil && wm.moveResize.window == ev.Window {
+				wm.endMoveResize(false)
+			}
+			wm.removeDock(ev.Window)
 			// if the destroy notify has come through but we haven't registered any kind of deletion then handle it
 			if _, ok := wm.windows[ev.Window]; ok {
 				wm.remDestroyedWin(ev.Window)
 			}
 			fmt.Println("finished destroying")
 		case xproto.EnterNotifyEvent:
+			wm.lastTime = ev.Time
 			// when we enter the frame, change the border color
 			fmt.Println("EnterNotify")
 			fmt.Println(ev.Event)
@@ -1038,27 +1753,95 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 			fmt.Println("LeaveNotify")
 			fmt.Println(ev.Event)
 			wm.onLeaveNotify(ev)
+		case xproto.MappingNotifyEvent:
+			// the keyboard layout changed (setxkbmap, another keyboard being plugged in...), so the keys in keybinds
+			// could be on other keycodes now
+			if ev.Request == xproto.MappingPointer {
+				break
+			}
+			wm.remapKeys()
+		case xproto.KeyReleaseEvent:
+			wm.lastTime = ev.Time
+			// the key is still held down, it is only repeating
+			if wm.isAutoRepeat(ev) {
+				break
+			}
+			wm.releaseKey(ev)
+			// the cycle ends once the keybind's modifiers are let go, shift is left out since it only changes direction
+			if wm.cycle != nil {
+				pointer, err := xproto.QueryPointer(wm.conn, wm.root).Reply()
+				if err != nil || pointer.Mask&wm.cycle.mods&^xproto.ModMaskShift == 0 {
+					wm.endCycleFocus()
+				}
+			}
 		case xproto.KeyPressEvent:
+			wm.lastTime = ev.Time
 			fmt.Println("keyPress")
-			// if mod key is down
-			if ev.State&mMask != 0 {
+			// a made up key press for keybinds that weren't pressed, see queueKeybinds
+			queued := wm.queuedBinds
+			wm.queuedBinds = nil
+			if wm.moveResize != nil && wm.moveResize.keyboard && queued == nil {
+				wm.moveResizeKey(ev)
+			} else {
+				// in a binding mode its keybinds are used instead
+				keybinds := wm.config.Keybinds
+				if wm.mode != "" {
+					keybinds = wm.modeKeybinds
+				}
+				state := wm.keybindState(ev.State)
+				// made up presses aren't the key repeating
+				repeat := queued == nil && ev.Detail == wm.repeatKey
+				if queued != nil {
+					keybinds = queued
+				} else {
+					wm.repeatKey = 0
+				}
+				if wm.chord != nil && queued == nil {
+					kb, ok := wm.continueChord(ev)
+					if !ok {
+						break
+					}
+					// the sequence is finished, run it like a plain keybind for this key
+					kb.Keycode, kb.Modifiers, kb.Then = uint32(ev.Detail), state, nil
+					keybinds = []Keybind{kb}
+				}
+				var prefixed []Keybind
 				// go through keybinds if the keybind matches up to the current event then continue
-				for _, kb := range wm.config.Keybinds {
-					if ev.Detail == xproto.Keycode(kb.Keycode) && (ev.State&(mMask|xproto.ModMaskShift) ==
-						(mMask | xproto.ModMaskShift) == kb.Shift) {
+				for _, kb := range keybinds {
+					if ev.Detail == xproto.Keycode(kb.Keycode) && state == kb.Modifiers {
+						if len(kb.Then) > 0 {
+							prefixed = append(prefixed, kb)
+							continue
+						}
+						if repeat && (kb.NoRepeat || kb.On == "release") {
+							continue
+						}
+						if kb.On == "release" {
+							wm.armed = append(wm.armed, kb)
+							continue
+						}
 						// if it has an exec then just execute it
 						if kb.Exec != "" {
 							fmt.Println("executing:", kb.Exec)
 							runCommand(kb.Exec)
 							fmt.Println("excuted")
 						}
+						if kb.Mode != "" {
+							wm.enterMode(kb.Mode)
+						}
+						// roles act on the focused window, which isn't always the one under the pointer
+						ev.Child = wm.focused
+						// so they also act on the monitor of that window, not the one with the pointer
+						if mon, _ := wm.locateWindow(ev.Child); mon != nil {
+							wm.currMonitor = mon
+						}
+						resize := uint16(kb.amount(int(wm.config.Resize), math.MaxUint16))
+						step := int16(kb.amount(10, math.MaxInt16))
 						switch kb.Role {
 						case "resize-x-scale-up":
 							if wm.currMonitor.CurrWorkspace.tiling {
-								if err := wm.pointerToWindow(ev.Child); err != nil {
-									slog.Error("Couldn't move pointer to window", "error:", err)
-								}
-								if !wm.resizeTiledX(true, ev) {
+								wm.keyboardFocus(ev.Child)
+								if !wm.resizeTiledX(true, resize, ev) {
 									break
 								}
 							} else {
@@ -1067,17 +1850,13 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 									break
 								}
 								xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowWidth,
-									[]uint32{uint32(geom.Width + uint16(wm.config.Resize))})
-								if err := wm.pointerToWindow(ev.Child); err != nil {
-									slog.Error("Couldn't move pointer to window", "error:", err)
-								}
+									[]uint32{uint32(geom.Width + resize)})
+								wm.keyboardFocus(ev.Child)
 							}
 						case "resize-x-scale-down":
 							if wm.currMonitor.CurrWorkspace.tiling {
-								if err := wm.pointerToWindow(ev.Child); err != nil {
-									slog.Error("Couldn't move pointer to window", "error:", err)
-								}
-								if !wm.resizeTiledX(false, ev) {
+								wm.keyboardFocus(ev.Child)
+								if !wm.resizeTiledX(false, resize, ev) {
 									break
 								}
 							} else {
@@ -1087,18 +1866,14 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 								}
 								if geom.Width > 10 {
 									xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowWidth,
-										[]uint32{uint32(geom.Width - uint16(wm.config.Resize))})
-									if err := wm.pointerToWindow(ev.Child); err != nil {
-										slog.Error("Couldn't move pointer to window", "error:", err)
-									}
+										[]uint32{uint32(geom.Width - resize)})
+									wm.keyboardFocus(ev.Child)
 								}
 							}
 						case "resize-y-scale-up":
 							if wm.currMonitor.CurrWorkspace.tiling {
-								if err := wm.pointerToWindow(ev.Child); err != nil {
-									slog.Error("Couldn't move pointer to window", "error:", err)
-								}
-								if !wm.resizeTiledY(true, ev) {
+								wm.keyboardFocus(ev.Child)
+								if !wm.resizeTiledY(true, resize, ev) {
 									break
 								}
 							} else {
@@ -1107,17 +1882,13 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 									break
 								}
 								xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowHeight,
-									[]uint32{uint32(geom.Height + uint16(wm.config.Resize))})
-								if err := wm.pointerToWindow(ev.Child); err != nil {
-									slog.Error("Couldn't move pointer to window", "error:", err)
-								}
+									[]uint32{uint32(geom.Height + resize)})
+								wm.keyboardFocus(ev.Child)
 							}
 						case "resize-y-scale-down":
 							if wm.currMonitor.CurrWorkspace.tiling {
-								if err := wm.pointerToWindow(ev.Child); err != nil {
-									slog.Error("Couldn't move pointer to window", "error:", err)
-								}
-								if !wm.resizeTiledY(false, ev) {
+								wm.keyboardFocus(ev.Child)
+								if !wm.resizeTiledY(false, resize, ev) {
 									break
 								}
 							} else {
@@ -1130,10 +1901,8 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 								}
 								if geom.Height > 10 {
 									xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowHeight,
-										[]uint32{uint32(geom.Height - uint16(wm.config.Resize))})
-									if err := wm.pointerToWindow(ev.Child); err != nil {
-										slog.Error("Couldn't move pointer to window", "error:", err)
-									}
+										[]uint32{uint32(geom.Height - resize)})
+									wm.keyboardFocus(ev.Child)
 								}
 							}
 						case "move-x-right":
@@ -1144,10 +1913,8 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 							if err != nil {
 								break
 							}
-							xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowX, []uint32{uint32(geom.X + 10)})
-							if err := wm.pointerToWindow(ev.Child); err != nil {
-								slog.Error("Couldn't move pointer to window", "error:", err)
-							}
+							xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowX, []uint32{uint32(geom.X + step)})
+							wm.keyboardFocus(ev.Child)
 						case "move-x-left":
 							if wm.currMonitor.CurrWorkspace.tiling {
 								break
@@ -1156,10 +1923,8 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 							if err != nil {
 								break
 							}
-							xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowX, []uint32{uint32(geom.X - 10)})
-							if err := wm.pointerToWindow(ev.Child); err != nil {
-								slog.Error("Couldn't move pointer to window", "error:", err)
-							}
+							xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowX, []uint32{uint32(geom.X - step)})
+							wm.keyboardFocus(ev.Child)
 						case "move-y-up":
 							if wm.currMonitor.CurrWorkspace.tiling {
 								break
@@ -1168,10 +1933,8 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 							if err != nil {
 								break
 							}
-							xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowY, []uint32{uint32(geom.Y - 10)})
-							if err := wm.pointerToWindow(ev.Child); err != nil {
-								slog.Error("Couldn't move pointer to window", "error:", err)
-							}
+							xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowY, []uint32{uint32(geom.Y - step)})
+							wm.keyboardFocus(ev.Child)
 						case "move-y-down":
 							if wm.currMonitor.CurrWorkspace.tiling {
 								break
@@ -1180,21 +1943,54 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 							if err != nil {
 								break
 							}
-							xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowY, []uint32{uint32(geom.Y + 10)})
-							if err := wm.pointerToWindow(ev.Child); err != nil {
-								slog.Error("Couldn't move pointer to window", "error:", err)
+							xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowY, []uint32{uint32(geom.Y + step)})
+							wm.keyboardFocus(ev.Child)
+						case "move-by":
+							if wm.currMonitor.CurrWorkspace.tiling {
+								break
+							}
+							geom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(ev.Child)).Reply()
+							if err != nil {
+								break
+							}
+							xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowX|xproto.ConfigWindowY, []uint32{
+								uint32(int(geom.X) + kb.arg("dx", 0)),
+								uint32(int(geom.Y) + kb.arg("dy", 0)),
+							})
+							wm.keyboardFocus(ev.Child)
+						case "resize-by":
+							if wm.currMonitor.CurrWorkspace.tiling {
+								break
+							}
+							geom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(ev.Child)).Reply()
+							if err != nil {
+								break
 							}
+							xproto.ConfigureWindowChecked(wm.conn, ev.Child, xproto.ConfigWindowWidth|xproto.ConfigWindowHeight, []uint32{
+								uint32(max(10, int(geom.Width)+kb.arg("dw", 0))),
+								uint32(max(10, int(geom.Height)+kb.arg("dh", 0))),
+							})
+							wm.keyboardFocus(ev.Child)
+						case "workspace":
+							wm.gotoWorkspace(kb.arg("index", 1)-1, 0)
+						case "move-to-workspace":
+							wm.gotoWorkspace(kb.arg("index", 1)-1, ev.Child)
 						case "quit":
-							if _, ok := wm.windows[ev.Child]; ok {
+							if win, ok := wm.windows[ev.Child]; ok {
 								// EMWH way of politely saying to destroy
-								if err := wm.sendWmDelete(wm.conn, wm.windows[ev.Child].id); err != nil {
+								if err := wm.sendWmDelete(wm.conn, win.id); err != nil {
 									slog.Error("send WmDelete", "error", err)
 								}
-								fmt.Println("closing window:", wm.windows[ev.Child].id, "frame:", ev.Child)
+								fmt.Println("closing window:", win.id, "frame:", ev.Child)
 							}
 						case "force-quit":
+							// nothing might have focus, e.g. after switching to an empty workspace
+							win, ok := wm.windows[ev.Child]
+							if !ok {
+								break
+							}
 							// force close
-							err := xproto.DestroyWindowChecked(wm.conn, wm.windows[ev.Child].id).Check()
+							err := xproto.DestroyWindowChecked(wm.conn, win.id).Check()
 							if err != nil {
 								fmt.Println("Couldn't force destroy:", err)
 							}
@@ -1214,6 +2010,43 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 							wm.fitToLayout()
 						case "toggle-fullscreen":
 							wm.toggleFullScreen(ev.Child)
+						case "minimize":
+							if _, ok := wm.windows[ev.Child]; ok {
+								wm.minimize(ev.Child)
+							}
+						case "focus-urgent":
+							if w, ok := wm.firstUrgent(); ok {
+								wm.activateWindow(w)
+							}
+						case "focus-last":
+							if w, ok := wm.lastFocused(); ok {
+								wm.activateWindow(w)
+							}
+						case "cycle-focus-next":
+							wm.cycleFocus(1, kb.Modifiers)
+						case "cycle-focus-prev":
+							wm.cycleFocus(-1, kb.Modifiers)
+						case "next-workspace":
+							wm.switchWorkspace((wm.currMonitor.workspaceIndex + 1) % len(wm.currMonitor.Workspaces))
+						case "prev-workspace":
+							n := len(wm.currMonitor.Workspaces)
+							wm.switchWorkspace((wm.currMonitor.workspaceIndex + n - 1) % n)
+						case "focus-left", "focus-right", "focus-up", "focus-down":
+							wm.focusDirection(ev.Child, directions[kb.Role[len("focus-"):]])
+						case "swap-left", "swap-right", "swap-up", "swap-down":
+							wm.swapDirection(ev.Child, directions[kb.Role[len("swap-"):]])
+						case "move-left", "move-right", "move-up", "move-down":
+							wm.moveDirection(ev.Child, directions[kb.Role[len("move-"):]])
+						case "restore-menu":
+							wm.restoreMenu()
+						case "restore-last":
+							wksp := wm.currMonitor.CurrWorkspace
+							if len(wksp.minimized) == 0 {
+								break
+							}
+							w := wksp.minimized[len(wksp.minimized)-1].id
+							wm.restore(w)
+							wm.keyboardFocus(w)
 						case "swap-window-left":
 							fmt.Println("swap left")
 							if wm.currMonitor.CurrWorkspace.tiling {
@@ -1227,9 +2060,7 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 											swapWindows(&wm.currMonitor.CurrWorkspace.windowList, i, i-1)
 										}
 										wm.fitToLayout()
-										if err := wm.pointerToWindow(currWindow); err != nil {
-											slog.Error("Couldn't move pointer to window", "error:", err)
-										}
+										wm.keyboardFocus(currWindow)
 										break swapLeft
 									}
 								}
@@ -1247,9 +2078,7 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 											swapWindows(&wm.currMonitor.CurrWorkspace.windowList, i, i+1)
 										}
 										wm.fitToLayout()
-										if err := wm.pointerToWindow(currWindow); err != nil {
-											slog.Error("Couldn't move pointer to window", "error:", err)
-										}
+										wm.keyboardFocus(currWindow)
 										break swapRight
 									}
 								}
@@ -1261,13 +2090,9 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 								for i := range wm.currMonitor.CurrWorkspace.windowList {
 									if currWindow == wm.currMonitor.CurrWorkspace.windowList[i].id {
 										if i == len(wm.currMonitor.CurrWorkspace.windowList)-1 {
-											if err := wm.pointerToWindow(wm.currMonitor.CurrWorkspace.windowList[0].id); err != nil {
-												slog.Error("Couldn't move pointer to window", "error:", err)
-											}
+											wm.keyboardFocus(wm.currMonitor.CurrWorkspace.windowList[0].id)
 										} else {
-											if err := wm.pointerToWindow(wm.currMonitor.CurrWorkspace.windowList[i+1].id); err != nil {
-												slog.Error("Couldn't move pointer to window", "error:", err)
-											}
+											wm.keyboardFocus(wm.currMonitor.CurrWorkspace.windowList[i+1].id)
 										}
 										break focusRight
 									}
@@ -1280,27 +2105,34 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 								for i := range wm.currMonitor.CurrWorkspace.windowList {
 									if currWindow == wm.currMonitor.CurrWorkspace.windowList[i].id {
 										if i == 0 {
-											err := wm.pointerToWindow(wm.currMonitor.CurrWorkspace.windowList[len(wm.currMonitor.CurrWorkspace.windowList)-1].id)
-											if err != nil {
-												slog.Error("Couldn't move pointer to window", "error:", err)
-											}
+											wm.keyboardFocus(wm.currMonitor.CurrWorkspace.windowList[len(wm.currMonitor.CurrWorkspace.windowList)-1].id)
 										} else {
-											if err := wm.pointerToWindow(wm.currMonitor.CurrWorkspace.windowList[i-1].id); err != nil {
-												slog.Error("Couldn't move pointer to window", "error:", err)
-											}
+											wm.keyboardFocus(wm.currMonitor.CurrWorkspace.windowList[i-1].id)
 										}
 										break focusLeft
 									}
 								}
 							}
 						case "reload-config":
-							cfg := createConfig()
+							cfg, err := createConfig()
+							if err != nil && cfg.ReloadErrorExec != "" {
+								runCommand(cfg.ReloadErrorExec, err.Error())
+							}
+							var warnings configWarnings
+							if err != nil && !errors.As(err, &warnings) {
+								// keep running with the config we have rather than the defaults, the file can't be read or isn't yaml
+								slog.Error("Couldn't reload config", "error:", err)
+								break
+							}
+							if err != nil {
+								slog.Warn("Problems in config", "error:", err)
+							}
 							wm.config = cfg
 							if len(wm.config.Monitors) != 0 {
 								wm.positionMonitors()
+								wm.setNetDesktopGeometry()
 							}
-							wm.reload(start)
-							mMask = wm.mod
+							wm.reload()
 
 						case "next-layout":
 							windowNum := len(wm.currMonitor.CurrWorkspace.windowList)
@@ -1318,72 +2150,37 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 							wm.currMonitor.CurrWorkspace.resizedLayout = ResizeLayout{}
 							wm.fitToLayout()
 						case "increase-gap":
-							wm.config.Gap++
+							wm.config.Gap += uint32(kb.amount(1, math.MaxUint16))
 							wm.fitToLayout()
 						case "decrease-gap":
-							if wm.config.Gap > 0 {
-								wm.config.Gap--
-							}
-							wm.fitToLayout()
-						}
-						switch kb.Key {
-						case "0", "1", "2", "3", "4", "5", "6", "7", "8", "9":
-							// if shift is pressed we want to move the window to the next workspace, so delete it from
-							// the record of the current workspace so when they unmap all the other windows (giving the
-							// illusion of changing workspace) this one stays then afterwards reparent it to the
-							// workspace that has been changed to
-							w := ev.Child
-							var window Window
-							shiftok := false
-							if kb.Shift {
-								if _, ok := wm.windows[w]; ok {
-									shiftok = ok
-									window = *wm.windows[w]
-									fmt.Println("moving window")
-									xproto.ConfigureWindow(
-										wm.conn,
-										w,
-										xproto.ConfigWindowStackMode,
-										[]uint32{xproto.StackModeAbove},
-									)
-									remove(&wm.currMonitor.CurrWorkspace.windowList, w)
-								}
-							}
-							switch kb.Key {
-							case "1":
-								wm.switchWorkspace(0)
-							case "2":
-								wm.switchWorkspace(1)
-							case "3":
-								wm.switchWorkspace(2)
-							case "4":
-								wm.switchWorkspace(3)
-							case "5":
-								wm.switchWorkspace(4)
-							case "6":
-								wm.switchWorkspace(5)
-							case "7":
-								wm.switchWorkspace(6)
-							case "8":
-								wm.switchWorkspace(7)
-							case "9":
-								wm.switchWorkspace(8)
-							case "0":
-								wm.switchWorkspace(9)
-							}
-							if kb.Shift && shiftok {
-								wm.currMonitor.CurrWorkspace.windowList = append(wm.currMonitor.CurrWorkspace.windowList, &window)
-								wm.setWindowDesktop(w, uint32(wm.currMonitor.workspaceIndex))
-							}
+							wm.config.Gap -= min(wm.config.Gap, uint32(kb.amount(1, math.MaxUint16)))
 							wm.fitToLayout()
 						}
 					}
 				}
+				if len(prefixed) > 0 {
+					wm.startChord(prefixed)
+				}
 			}
 
+		case xproto.PropertyNotifyEvent:
+			wm.onPropertyNotify(ev)
 		case xproto.ClientMessageEvent:
 			fmt.Println("client message")
 
+			// sent to ourselves when a keybind sequence has waited too long for its next key
+			if ev.Type == wm.atoms["_DOWM_CHORD_TIMEOUT"] {
+				if wm.chord != nil && ev.Data.Data32[0] == wm.chord.serial {
+					wm.cancelChord()
+				}
+				break
+			}
+			// sent to ourselves with the window picked in the restore menu
+			if ev.Type == wm.atoms["_DOWM_RESTORE"] {
+				wm.activateWindow(xproto.Window(ev.Data.Data32[0]))
+				break
+			}
+
 			atomName, _ := xproto.GetAtomName(wm.conn, ev.Type).Reply()
 			fmt.Println("ClientMessage atom:", atomName.Name)
 
@@ -1392,46 +2189,56 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 				wm.switchWorkspace(desktop)
 			}
 
-			if atomName.Name == "_NET_WM_STATE" && wm.config.AutoFullscreen {
-				fullscreenAtom, _ := wm.internAtom("_NET_WM_STATE_FULLSCREEN")
-				maxHorzAtom, _ := wm.internAtom("_NET_WM_STATE_MAXIMIZED_HORZ")
-				maxVertAtom, _ := wm.internAtom("_NET_WM_STATE_MAXIMIZED_VERT")
+			// a taskbar, rofi or the app itself asking for a window to be focused
+			if atomName.Name == "_NET_ACTIVE_WINDOW" {
+				if _, ok := wm.windows[ev.Window]; ok {
+					wm.onActivateRequest(ev.Window, ev.Data.Data32[0])
+				}
+			}
 
-				action := ev.Data.Data32[0] // 0 = remove, 1 = add, 2 = toggle
-				prop1 := ev.Data.Data32[1]
-				prop2 := ev.Data.Data32[2]
+			// a taskbar or pager asking us to close a window
+			if atomName.Name == "_NET_CLOSE_WINDOW" {
+				if _, ok := wm.windows[ev.Window]; ok {
+					if err := wm.sendWmDelete(wm.conn, ev.Window); err != nil {
+						slog.Error("send WmDelete", "error", err)
+					}
+				}
+			}
 
-				if _, ok := wm.windows[ev.Window]; !ok {
-					break
+			// client side decorations asking us to move or resize them (e.g. dragging a GTK header bar)
+			if atomName.Name == "_NET_WM_MOVERESIZE" {
+				if _, ok := wm.windows[ev.Window]; ok {
+					wm.startMoveResize(
+						ev.Window,
+						int16(ev.Data.Data32[0]),
+						int16(ev.Data.Data32[1]),
+						ev.Data.Data32[2],
+						ev.Data.Data32[3],
+					)
 				}
+			}
 
-				if prop1 == uint32(maxHorzAtom) || prop2 == uint32(maxHorzAtom) ||
-					prop1 == uint32(maxVertAtom) || prop2 == uint32(maxVertAtom) {
-					fmt.Println("maximized called, action", action)
-					switch action {
-					case 0: // remove
-						wm.disableFullscreen(wm.windows[ev.Window], ev.Window)
-					case 1: // add
-						wm.fullscreen(wm.windows[ev.Window], ev.Window)
-					case 2: // toggle
-						wm.toggleFullScreen(ev.Window)
-					}
-					break
+			// a pager asking for a window to be moved to another workspace
+			if atomName.Name == "_NET_WM_DESKTOP" {
+				if _, ok := wm.windows[ev.Window]; ok {
+					wm.moveWindowToWorkspace(ev.Window, ev.Data.Data32[0])
 				}
-				if prop1 == uint32(fullscreenAtom) || prop2 == uint32(fullscreenAtom) {
-					fmt.Println("Fullscreen request! Action:", action)
-
-					switch action {
-					case 0: // remove
-						wm.disableFullscreen(wm.windows[ev.Window], ev.Window)
-					case 1: // add
-						wm.fullscreen(wm.windows[ev.Window], ev.Window)
-					case 2: // toggle
-						wm.toggleFullScreen(ev.Window)
-					}
+			}
+
+			// ICCCM way of asking to be iconified, the only state change a client can ask for with it
+			if atomName.Name == "WM_CHANGE_STATE" && ev.Data.Data32[0] == wmStateIconic {
+				if _, ok := wm.windows[ev.Window]; ok {
+					wm.minimize(ev.Window)
 				}
 			}
 
+			if atomName.Name == "_NET_WM_STATE" {
+				if _, ok := wm.windows[ev.Window]; !ok {
+					break
+				}
+				wm.onNetWMStateMessage(ev)
+			}
+
 		default:
 			fmt.Println("event: " + event.String())
 			fmt.Println(event.Bytes()) //nolint:staticcheck
@@ -1439,7 +2246,257 @@ func (wm *WindowManager) Run() { //nolint:cyclop
 	}
 }
 
-func (wm *WindowManager) resizeTiledX(increase bool, ev xproto.KeyPressEvent) bool { //nolint:unparam
+// _NET_WM_MOVERESIZE directions.
+const (
+	moveResizeTopLeft     = 0
+	moveResizeTop         = 1
+	moveResizeTopRight    = 2
+	moveResizeRight       = 3
+	moveResizeBottomRight = 4
+	moveResizeBottom      = 5
+	moveResizeBottomLeft  = 6
+	moveResizeLeft        = 7
+	moveResizeMove        = 8
+	moveResizeSizeKbd     = 9
+	moveResizeMoveKbd     = 10
+	moveResizeCancel      = 11
+)
+
+func (wm *WindowManager) startMoveResize(w xproto.Window, rootX, rootY int16, direction, button uint32) {
+	// the client saw the button go up before we grabbed it, so stop where it is
+	if direction == moveResizeCancel {
+		if wm.moveResize != nil && wm.moveResize.window == w {
+			wm.endMoveResize(false)
+		}
+		return
+	}
+	if direction > moveResizeCancel || wm.moveResize != nil {
+		return
+	}
+
+	win := wm.windows[w]
+	if win.Fullscreen {
+		return
+	}
+	// tiled windows get their size from the layout, they can only be dragged to swap them
+	move := direction == moveResizeMove || direction == moveResizeMoveKbd
+	if wm.currMonitor.CurrWorkspace.tiling && !move {
+		return
+	}
+
+	geom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(w)).Reply()
+	if err != nil {
+		return
+	}
+
+	pointer, err := xproto.QueryPointer(wm.conn, wm.root).Reply()
+	if err != nil {
+		return
+	}
+	keyboard := direction == moveResizeSizeKbd || direction == moveResizeMoveKbd
+	if keyboard {
+		// keyboard moves and resizes start from wherever the pointer is
+		rootX, rootY = pointer.RootX, pointer.RootY
+	} else if !buttonHeld(pointer.Mask, button) {
+		// the button was let go before the message got here, grabbing now would never see it released
+		return
+	}
+
+	grab, err := xproto.GrabPointer(
+		wm.conn,
+		false,
+		wm.root,
+		uint16(xproto.EventMaskButtonPress|xproto.EventMaskButtonRelease|xproto.EventMaskPointerMotion),
+		xproto.GrabModeAsync,
+		xproto.GrabModeAsync,
+		xproto.WindowNone,
+		xproto.CursorNone,
+		xproto.TimeCurrentTime,
+	).Reply()
+	if err != nil || grab.Status != xproto.GrabStatusSuccess {
+		slog.Error("Couldn't grab pointer for move/resize", "error:", err)
+		return
+	}
+
+	if keyboard {
+		grabKbd, err := xproto.GrabKeyboard(
+			wm.conn,
+			false,
+			wm.root,
+			xproto.TimeCurrentTime,
+			xproto.GrabModeAsync,
+			xproto.GrabModeAsync,
+		).Reply()
+		if err != nil || grabKbd.Status != xproto.GrabStatusSuccess {
+			slog.Error("Couldn't grab keyboard for move/resize", "error:", err)
+			xproto.UngrabPointer(wm.conn, xproto.TimeCurrentTime)
+			return
+		}
+	}
+
+	wm.raise(w)
+	wm.moveResize = &moveResize{
+		window:    w,
+		direction: direction,
+		keyboard:  keyboard,
+		startX:    rootX,
+		startY:    rootY,
+		geom: Space{
+			X:      int(geom.X),
+			Y:      int(geom.Y),
+			Width:  int(geom.Width),
+			Height: int(geom.Height),
+		},
+	}
+}
+
+// buttonHeld checks a pointer state for a button being down, button 0 means any of them.
+func buttonHeld(mask uint16, button uint32) bool {
+	if button == 0 {
+		return mask&(xproto.KeyButMaskButton1|xproto.KeyButMaskButton2|xproto.KeyButMaskButton3|
+			xproto.KeyButMaskButton4|xproto.KeyButMaskButton5) != 0
+	}
+	return button <= 5 && mask&(xproto.KeyButMaskButton1<<(button-1)) != 0
+}
+
+func (wm *WindowManager) moveResizeMotion(rootX, rootY int16) {
+	mr := wm.moveResize
+	mr.offX = rootX - mr.startX
+	mr.offY = rootY - mr.startY
+	wm.applyMoveResize()
+}
+
+// moveResizeKey handles the arrow keys, return and escape during a keyboard move or resize.
+func (wm *WindowManager) moveResizeKey(ev xproto.KeyPressEvent) {
+	mr := wm.moveResize
+	step := int16(10)
+	if mr.direction == moveResizeSizeKbd {
+		step = int16(wm.config.Resize)
+	}
+
+	switch keybind.LookupString(XUtil, 0, ev.Detail) {
+	case "Left":
+		mr.offX -= step
+	case "Right":
+		mr.offX += step
+	case "Up":
+		mr.offY -= step
+	case "Down":
+		mr.offY += step
+	case "Return", "KP_Enter":
+		wm.endMoveResize(false)
+		return
+	case "Escape":
+		wm.endMoveResize(true)
+		return
+	default:
+		return
+	}
+	wm.applyMoveResize()
+}
+
+func (wm *WindowManager) applyMoveResize() {
+	mr := wm.moveResize
+	dx, dy := int(mr.offX), int(mr.offY)
+	x, y, width, height := mr.geom.X, mr.geom.Y, mr.geom.Width, mr.geom.Height
+
+	if mr.direction == moveResizeMove || mr.direction == moveResizeMoveKbd {
+		wm.configureWindow(mr.window, x+dx, y+dy, width, height)
+		return
+	}
+
+	// work out which edges are being dragged
+	fromLeft, fromTop := false, false
+	switch mr.direction {
+	case moveResizeTopLeft, moveResizeLeft, moveResizeBottomLeft:
+		fromLeft = true
+		width -= dx
+	case moveResizeTopRight, moveResizeRight, moveResizeBottomRight, moveResizeSizeKbd:
+		width += dx
+	}
+	switch mr.direction {
+	case moveResizeTopLeft, moveResizeTop, moveResizeTopRight:
+		fromTop = true
+		height -= dy
+	case moveResizeBottomLeft, moveResizeBottom, moveResizeBottomRight, moveResizeSizeKbd:
+		height += dy
+	}
+
+	// keep within the size the window says it can be, keeping the opposite edge still when it hits a limit
+	hints := wm.windows[mr.window].SizeHints
+	minWidth, minHeight := max(10, hints.MinWidth), max(10, hints.MinHeight)
+	if hints.MaxWidth > 0 && width > hints.MaxWidth {
+		width = hints.MaxWidth
+	}
+	if hints.MaxHeight > 0 && height > hints.MaxHeight {
+		height = hints.MaxHeight
+	}
+	width = max(width, minWidth)
+	height = max(height, minHeight)
+	// things like terminals resize a character cell at a time
+	width = stepSize(width, hints.BaseWidth, hints.WidthInc, minWidth)
+	height = stepSize(height, hints.BaseHeight, hints.HeightInc, minHeight)
+	if fromLeft {
+		x = mr.geom.X + mr.geom.Width - width
+	}
+	if fromTop {
+		y = mr.geom.Y + mr.geom.Height - height
+	}
+
+	wm.configureWindow(mr.window, x, y, width, height)
+}
+
+// stepSize takes a size down to the base size plus a whole number of increments, staying at least minimum.
+func stepSize(size, base, inc, minimum int) int {
+	if inc <= 1 || size <= base {
+		return size
+	}
+	size -= (size - base) % inc
+	for size < minimum {
+		size += inc
+	}
+	return size
+}
+
+// endMoveResize releases the grabs, if cancelled the window goes back to where it was and if tiling it swaps with the
+// window it was dropped on.
+func (wm *WindowManager) endMoveResize(cancel bool) {
+	mr := wm.moveResize
+	wm.moveResize = nil
+
+	xproto.UngrabPointer(wm.conn, xproto.TimeCurrentTime)
+	if mr.keyboard {
+		xproto.UngrabKeyboard(wm.conn, xproto.TimeCurrentTime)
+	}
+
+	if cancel {
+		wm.configureWindow(mr.window, mr.geom.X, mr.geom.Y, mr.geom.Width, mr.geom.Height)
+	}
+
+	if !wm.currMonitor.CurrWorkspace.tiling {
+		return
+	}
+	pointer, err := xproto.QueryPointer(wm.conn, wm.root).Reply()
+	if err == nil && !cancel {
+		for _, window := range wm.currMonitor.CurrWorkspace.windowList {
+			if window.id == mr.window {
+				continue
+			}
+			geom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(window.id)).Reply()
+			if err != nil {
+				continue
+			}
+			if pointer.RootX > geom.X && pointer.RootX < geom.X+int16(geom.Width) &&
+				pointer.RootY > geom.Y && pointer.RootY < geom.Y+int16(geom.Height) {
+				swapWindowsID(&wm.currMonitor.CurrWorkspace.windowList, mr.window, window.id)
+				break
+			}
+		}
+	}
+	wm.fitToLayout()
+}
+
+func (wm *WindowManager) resizeTiledX(increase bool, amount uint16, ev xproto.KeyPressEvent) bool { //nolint:unparam
 	geom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(ev.Child)).Reply()
 	if err != nil {
 		return false
@@ -1464,22 +2521,22 @@ func (wm *WindowManager) resizeTiledX(increase bool, ev xproto.KeyPressEvent) bo
 		// if diff between ends of windows it less than five, they are same column
 		if math.Abs(float64((X+W)-(winX+winW))) <= 10 {
 			if increase {
-				winW += uint16(wm.config.Resize)
+				winW += amount
 			} else {
-				winW -= uint16(wm.config.Resize)
+				winW -= amount
 			}
 			fmt.Println(winW)
 		} else if math.Abs(float64(int(winX)-(int(X)+int(W)))) <= 10 {
 			if increase {
-				winX += uint16(wm.config.Resize)
-				winW -= uint16(wm.config.Resize)
+				winX += amount
+				winW -= amount
 				if winW < 50 {
 					ok = false
 					break
 				}
 			} else {
-				winX -= uint16(wm.config.Resize)
-				winW += uint16(wm.config.Resize)
+				winX -= amount
+				winW += amount
 				if W < 50 {
 					ok = false
 					break
@@ -1505,7 +2562,7 @@ func (wm *WindowManager) resizeTiledX(increase bool, ev xproto.KeyPressEvent) bo
 	return false
 }
 
-func (wm *WindowManager) resizeTiledY(increase bool, ev xproto.KeyPressEvent) bool { //nolint:unparam
+func (wm *WindowManager) resizeTiledY(increase bool, amount uint16, ev xproto.KeyPressEvent) bool { //nolint:unparam
 	geom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(ev.Child)).Reply()
 	if err != nil {
 		return false
@@ -1530,22 +2587,22 @@ func (wm *WindowManager) resizeTiledY(increase bool, ev xproto.KeyPressEvent) bo
 		// if diff between ends of windows it less than five, they are same column
 		if math.Abs(float64((int(Y)+int(H))-(int(winY)+int(winH)))) <= 10 {
 			if increase {
-				winH += uint16(wm.config.Resize)
+				winH += amount
 			} else {
-				winH -= uint16(wm.config.Resize)
+				winH -= amount
 			}
 			fmt.Println(winW)
 		} else if math.Abs(float64(int(winY)-(int(Y)+int(H)))) <= 10 {
 			if increase {
-				winY += uint16(wm.config.Resize)
-				winH -= uint16(wm.config.Resize)
+				winY += amount
+				winH -= amount
 				if winH < 50 {
 					ok = false
 					break
 				}
 			} else {
-				winY -= uint16(wm.config.Resize)
-				winH += uint16(wm.config.Resize)
+				winY -= amount
+				winH += amount
 				if H < 50 {
 					ok = false
 					break
@@ -1583,19 +2640,41 @@ func (wm *WindowManager) declareSupportedAtoms() {
 	// List the names of EWMH atoms your WM supports
 	atomNames := []string{
 		"_NET_SUPPORTED",
-		"_NET_WM_STATE",
+		"_NET_SUPPORTING_WM_CHECK",
 		"_NET_WM_NAME",
-		"_WM_NAME",
-		"_NET_WM_STATE_FULLSCREEN",
 		"_NET_CURRENT_DESKTOP",
 		"_NET_NUMBER_OF_DESKTOPS",
 		"_NET_ACTIVE_WINDOW",
-		"_NET_WM_DESKTOP",
-		"_NET_CLIENT_LIST",
 		"_NET_CLOSE_WINDOW",
 		"_NET_WM_MOVERESIZE",
+		"_NET_WORKAREA",
+		"_NET_DESKTOP_GEOMETRY",
+		"_NET_DESKTOP_VIEWPORT",
+		"_NET_CLIENT_LIST",
+		"_NET_CLIENT_LIST_STACKING",
+		"_NET_WM_DESKTOP",
+		"_NET_WM_WINDOW_TYPE",
+		"_NET_WM_WINDOW_TYPE_NORMAL",
+		"_NET_WM_WINDOW_TYPE_DOCK",
+		"_NET_WM_WINDOW_TYPE_DIALOG",
+		"_NET_WM_WINDOW_TYPE_SPLASH",
+		"_NET_WM_WINDOW_TYPE_NOTIFICATION",
+		"_NET_WM_WINDOW_TYPE_TOOLTIP",
+		"_NET_WM_STRUT_PARTIAL",
+		"_NET_WM_STRUT",
+		"_NET_WM_STATE",
+		"_NET_WM_STATE_FULLSCREEN",
 		"_NET_WM_STATE_MAXIMIZED_HORZ",
 		"_NET_WM_STATE_MAXIMIZED_VERT",
+		"_NET_WM_STATE_HIDDEN",
+		"_NET_WM_STATE_ABOVE",
+		"_NET_WM_STATE_BELOW",
+		"_NET_WM_STATE_STICKY",
+		"_NET_WM_STATE_SHADED",
+		"_NET_WM_STATE_MODAL",
+		"_NET_WM_STATE_SKIP_TASKBAR",
+		"_NET_WM_STATE_SKIP_PAGER",
+		"_NET_WM_STATE_DEMANDS_ATTENTION",
 	}
 
 	atoms := make([]xproto.Atom, 0, len(atomNames))
@@ -1631,20 +2710,63 @@ func (wm *WindowManager) declareSupportedAtoms() {
 	}
 }
 
-func focusWindow(conn *xgb.Conn, win xproto.Window) {
-	err := xproto.SetInputFocusChecked(
-		conn,
-		xproto.InputFocusPointerRoot, // or InputFocusNone / InputFocusParent
-		win,
-		xproto.TimeCurrentTime,
-	).Check()
+// createSupportingWMCheck creates the child window EWMH uses to show a compliant window manager is running, it is
+// never mapped and just holds our name so things like wmctrl -m and neofetch can tell who we are.
+func (wm *WindowManager) createSupportingWMCheck() {
+	win, err := xproto.NewWindowId(wm.conn)
 	if err != nil {
-		fmt.Println("Error focusing window:", err)
+		slog.Error("Couldn't allocate supporting wm check window id", "error:", err)
+		return
 	}
-}
 
-func swapWindows(arr *[]*Window, first int, last int) {
-	(*arr)[first], (*arr)[last] = (*arr)[last], (*arr)[first]
+	err = xproto.CreateWindowChecked(
+		wm.conn,
+		0,
+		win,
+		wm.root,
+		-1, -1, 1, 1, 0,
+		xproto.WindowClassInputOnly,
+		0,
+		xproto.CwOverrideRedirect,
+		[]uint32{1},
+	).Check()
+	if err != nil {
+		slog.Error("Couldn't create supporting wm check window", "error:", err)
+		return
+	}
+	wm.checkWin = win
+
+	checkAtom := wm.atoms["_NET_SUPPORTING_WM_CHECK"]
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(win))
+
+	// the property has to be on both the root and the check window itself, pointing at the check window
+	for _, w := range []xproto.Window{wm.root, win} {
+		err = xproto.ChangePropertyChecked(wm.conn, xproto.PropModeReplace, w, checkAtom, xproto.AtomWindow, 32, 1, data).
+			Check()
+		if err != nil {
+			slog.Error("Couldn't set _NET_SUPPORTING_WM_CHECK", "error:", err)
+		}
+	}
+
+	name := "doWM"
+	err = xproto.ChangePropertyChecked(
+		wm.conn,
+		xproto.PropModeReplace,
+		win,
+		wm.atoms["_NET_WM_NAME"],
+		wm.atoms["UTF8_STRING"],
+		8,
+		uint32(len(name)),
+		[]byte(name),
+	).Check()
+	if err != nil {
+		slog.Error("Couldn't set _NET_WM_NAME on check window", "error:", err)
+	}
+}
+
+func swapWindows(arr *[]*Window, first int, last int) {
+	(*arr)[first], (*arr)[last] = (*arr)[last], (*arr)[first]
 }
 
 func swapWindowsID(arr *[]*Window, first xproto.Window, last xproto.Window) {
@@ -1672,13 +2794,24 @@ func remove(arr *[]*Window, id xproto.Window) {
 	}
 }
 
-func runCommand(cmdStr string) {
+func removeID(arr *[]xproto.Window, id xproto.Window) {
+	for index := range *arr {
+		if (*arr)[index] == id {
+			*arr = append((*arr)[:index], (*arr)[index+1:]...)
+			return
+		}
+	}
+}
+
+// runCommand starts a command line, any extra arguments are added to the end of it.
+func runCommand(cmdStr string, extra ...string) {
 	parser := shellwords.NewParser()
 	args, err := parser.Parse(cmdStr)
 	if err != nil {
 		slog.Error("Parsing error:", "error:", err)
 		return
 	}
+	args = append(args, extra...)
 	if len(args) == 0 {
 		return
 	}
@@ -1691,88 +2824,122 @@ func runCommand(cmdStr string) {
 	_ = cmd.Start()
 }
 
-func (wm *WindowManager) getBar(vals []byte) (int, int, int, int) {
-	// calculates where the bar is (more explanatary in createTilingSpace)
+// strut is the space a dock/bar reserves along the edges of the whole screen, with the range along each edge it covers
+// (from _NET_WM_STRUT_PARTIAL, or the whole edge for the older _NET_WM_STRUT).
+type strut struct {
+	left, right, top, bottom int
+	leftStartY, leftEndY     int
+	rightStartY, rightEndY   int
+	topStartX, topEndX       int
+	bottomStartX, bottomEndX int
+}
 
-	var maxLeft, maxRight, maxTop, maxBottom int
-	left := int(binary.LittleEndian.Uint32(vals[0:4]))
-	right := int(binary.LittleEndian.Uint32(vals[4:8]))
-	top := int(binary.LittleEndian.Uint32(vals[8:12]))
-	bottom := int(binary.LittleEndian.Uint32(vals[12:16]))
+func (wm *WindowManager) getStrut(window xproto.Window) (strut, bool) {
+	prop, err := xproto.GetProperty(wm.conn, false, window, wm.atoms["_NET_WM_STRUT_PARTIAL"], xproto.AtomCardinal, 0, 12).
+		Reply()
+	if err == nil && prop.Format == 32 && len(prop.Value) >= 48 {
+		v := func(i int) int { return int(binary.LittleEndian.Uint32(prop.Value[i*4:])) }
+		return strut{
+			left: v(0), right: v(1), top: v(2), bottom: v(3),
+			leftStartY: v(4), leftEndY: v(5),
+			rightStartY: v(6), rightEndY: v(7),
+			topStartX: v(8), topEndX: v(9),
+			bottomStartX: v(10), bottomEndX: v(11),
+		}, true
+	}
+
+	prop, err = xproto.GetProperty(wm.conn, false, window, wm.atoms["_NET_WM_STRUT"], xproto.AtomCardinal, 0, 4).
+		Reply()
+	if err == nil && prop.Format == 32 && len(prop.Value) >= 16 {
+		v := func(i int) int { return int(binary.LittleEndian.Uint32(prop.Value[i*4:])) }
+		return strut{
+			left: v(0), right: v(1), top: v(2), bottom: v(3),
+			leftStartY: 0, leftEndY: math.MaxInt32,
+			rightStartY: 0, rightEndY: math.MaxInt32,
+			topStartX: 0, topEndX: math.MaxInt32,
+			bottomStartX: 0, bottomEndX: math.MaxInt32,
+		}, true
+	}
+
+	return strut{}, false
+}
 
-	if left > maxLeft {
-		maxLeft = left
-	}
-	if right > maxRight {
-		maxRight = right
-	}
-	if top > maxTop {
-		maxTop = top
-	}
-	if bottom > maxBottom {
-		maxBottom = bottom
+// updateStrut reads the struts of a dock again, for when it maps or changes them.
+func (wm *WindowManager) updateStrut(dock xproto.Window) {
+	if st, ok := wm.getStrut(dock); ok {
+		wm.struts[dock] = st
+	} else {
+		delete(wm.struts, dock)
 	}
-	return maxLeft, maxRight, maxTop, maxBottom
 }
 
-func (wm *WindowManager) createTilingSpace() {
-	// look at all windows and if it has the property _NET_WM_STRUT_PARTIAL (what most bars have) it means that it
-	// should be worked around
-	windows, _ := xproto.QueryTree(wm.conn, wm.root).Reply()
-	X := 0
-	Y := 0
-	width := wm.currMonitor.Width
-	height := wm.currMonitor.Height
-	fmt.Println("CURR MON VALS X", wm.currMonitor.X, "Y", wm.currMonitor.Y)
-
-	for _, window := range windows.Children {
-		geom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(window)).Reply()
-		if err != nil {
-			continue
-		}
+// overlaps is whether the range start-end (inclusive) touches the range from-(from+length).
+func overlaps(start, end, from, length int) bool {
+	return start < from+length && end >= from
+}
 
-		mon := wm.currMonitor
-		if geom.X < mon.X || geom.X > mon.X+int16(mon.Width) || geom.Y < mon.Y || geom.Y > mon.Y+int16(mon.Height) {
-			continue
-		}
+// workArea is the part of a monitor that isn't reserved by bars.
+func (wm *WindowManager) workArea(mon *Monitor) Space {
+	// the docks that are mapped (what bars are) have their _NET_WM_STRUT_PARTIAL or _NET_WM_STRUT kept in wm.struts,
+	// that space should be worked around, struts are from the edges of the whole screen so only the bits that are on
+	// this monitor count
+	mx, my, mw, mh := int(mon.X), int(mon.Y), int(mon.Width), int(mon.Height)
+	var left, right, top, bottom int
 
-		attributes, err := xproto.GetWindowAttributes(wm.conn, window).Reply()
-		if err != nil {
-			continue
-		}
-		if attributes.MapState == xproto.MapStateViewable {
-			atom := wm.atoms["_NET_WM_STRUT_PARTIAL"]
-			prop, err := xproto.GetProperty(wm.conn, false, window, atom, xproto.AtomCardinal, 0, 12).
-				Reply()
+	rootGeom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(wm.root)).Reply()
+	if err == nil {
+		sw, sh := int(rootGeom.Width), int(rootGeom.Height)
 
-			if err != nil || prop == nil || prop.ValueLen < 4 {
-				continue
+		for _, st := range wm.struts {
+			if st.left > 0 && overlaps(st.leftStartY, st.leftEndY, my, mh) {
+				left = max(left, st.left-mx)
 			}
-
-			vals := prop.Value
-			if len(vals) < 16 {
-				continue // need at least 4 uint32s
+			if st.right > 0 && overlaps(st.rightStartY, st.rightEndY, my, mh) {
+				right = max(right, (mx+mw)-(sw-st.right))
 			}
-			left, right, top, bottom := wm.getBar(vals)
+			if st.top > 0 && overlaps(st.topStartX, st.topEndX, mx, mw) {
+				top = max(top, st.top-my)
+			}
+			if st.bottom > 0 && overlaps(st.bottomStartX, st.bottomEndX, mx, mw) {
+				bottom = max(bottom, (my+mh)-(sh-st.bottom))
+			}
+		}
+	}
 
-			// create space to work around bar (if there is one)
-			X = left
-			Y = top
-			width = uint16(int(wm.currMonitor.Width) - left - right)
-			height = uint16(int(wm.currMonitor.Height) - top - bottom)
+	// a strut can't take more than the monitor
+	left, right = min(left, mw), min(right, mw-left)
+	top, bottom = min(top, mh), min(bottom, mh-top)
 
-			// TODO: support multiple bars
-			break
-		}
+	return Space{
+		X:      mx + left,
+		Y:      my + top,
+		Width:  mw - left - right,
+		Height: mh - top - bottom,
 	}
+}
+
+func (wm *WindowManager) createTilingSpace() {
+	area := wm.workArea(wm.currMonitor)
 
-	fmt.Println("tiling container:", "X:", X, "Y:", Y, "Width:", width, "Height:", height)
+	fmt.Println("tiling container:", "X:", area.X, "Y:", area.Y, "Width:", area.Width, "Height:", area.Height)
 	wm.currMonitor.TilingSpace = Space{
-		X:      int(wm.currMonitor.X) + X + int(wm.config.OuterGap),
-		Y:      int(wm.currMonitor.Y) + Y + int(wm.config.OuterGap),
-		Width:  int(width-6) - (int(wm.config.OuterGap) * 2),
-		Height: int(height-6) - (int(wm.config.OuterGap) * 2),
+		X:      area.X + int(wm.config.OuterGap),
+		Y:      area.Y + int(wm.config.OuterGap),
+		Width:  area.Width - 6 - (int(wm.config.OuterGap) * 2),
+		Height: area.Height - 6 - (int(wm.config.OuterGap) * 2),
+	}
+}
+
+// retile works the tiling space out again on every monitor, for when a bar appears, disappears or changes size.
+func (wm *WindowManager) retile() {
+	cm := wm.currMonitor
+	for i := range wm.monitors {
+		wm.currMonitor = &wm.monitors[i]
+		wm.createTilingSpace()
+		wm.fitToLayout()
 	}
+	wm.currMonitor = cm
+	wm.setNetWorkArea()
 }
 
 func (wm *WindowManager) fitToLayout() {
@@ -1854,12 +3021,6 @@ func (wm *WindowManager) fitToLayout() {
 	}
 	if len(fullscreen) > 0 {
 		for _, win := range fullscreen {
-			xproto.ConfigureWindow(
-				wm.conn,
-				win,
-				xproto.ConfigWindowStackMode,
-				[]uint32{xproto.StackModeAbove},
-			)
 			wm.fullscreen(wm.windows[win], win)
 		}
 	}
@@ -1910,18 +3071,18 @@ func (wm *WindowManager) enableTiling() {
 	wm.currMonitor.CurrWorkspace.tiling = true
 	// make sure no windows are fullscreened and that there state is saved (so it can be restored later if/when the user
 	// disables tiling)
-	for i, window := range wm.currMonitor.CurrWorkspace.windowList {
+	// (updated in place so wm.windows still points at the same window)
+	for _, window := range wm.currMonitor.CurrWorkspace.windowList {
 		fmt.Println(window.id)
-		attr, _ := xproto.GetGeometry(wm.conn, xproto.Drawable(window.id)).Reply()
-		wm.currMonitor.CurrWorkspace.windowList[i] = &Window{
-			id:         window.id,
-			X:          int(attr.X),
-			Y:          int(attr.Y),
-			Width:      int(attr.Width),
-			Height:     int(attr.Height),
-			Fullscreen: false,
-			Client:     window.Client,
+		attr, err := xproto.GetGeometry(wm.conn, xproto.Drawable(window.id)).Reply()
+		if err != nil {
+			continue
 		}
+		window.X = int(attr.X)
+		window.Y = int(attr.Y)
+		window.Width = int(attr.Width)
+		window.Height = int(attr.Height)
+		window.Fullscreen = false
 	}
 	fmt.Println("tiling")
 	// put the windows in the right tiling layout in the right space
@@ -1968,48 +3129,290 @@ func (wm *WindowManager) disableFullscreen(win *Window, child xproto.Window) {
 		slog.Error("Couldn't un-fullscreen window", "error: ", err)
 	}
 	wm.removeFullScreenEWMH(child)
+	wm.restack()
 	wm.fitToLayout()
 }
 
-func (wm *WindowManager) setFullScreenEWMH(win xproto.Window) {
-	// Intern the atoms we need
-	netWmState := wm.atoms["_NET_WM_STATE"]
-	netWmStateFullscreen := wm.atoms["_NET_WM_STATE_FULLSCREEN"]
+// _NET_WM_STATE client message actions.
+const (
+	netWMStateRemove = 0
+	netWMStateAdd    = 1
+	netWMStateToggle = 2
+)
 
-	data := make([]byte, 4)
-	binary.LittleEndian.PutUint32(data, uint32(netWmStateFullscreen))
-	// Change the window property to include fullscreen
-	err := xproto.ChangePropertyChecked(
-		wm.conn,
-		xproto.PropModeReplace,
-		win,
-		netWmState,
-		xproto.AtomAtom,
-		32,
-		1,
-		data,
-	).Check()
-	if err != nil {
+// onNetWMStateMessage handles a client asking to change one or two of its _NET_WM_STATE states.
+func (wm *WindowManager) onNetWMStateMessage(ev xproto.ClientMessageEvent) {
+	action := ev.Data.Data32[0]
+	prop1 := xproto.Atom(ev.Data.Data32[1])
+	prop2 := xproto.Atom(ev.Data.Data32[2])
+
+	// maximizing is treated as fullscreen, and usually comes as horizontal and vertical together so only do it once
+	maxHorz, maxVert := wm.atoms["_NET_WM_STATE_MAXIMIZED_HORZ"], wm.atoms["_NET_WM_STATE_MAXIMIZED_VERT"]
+	if prop1 == maxHorz || prop1 == maxVert || prop2 == maxHorz || prop2 == maxVert {
+		fmt.Println("maximized called, action", action)
+		wm.applyNetWMState(ev.Window, action, wm.atoms["_NET_WM_STATE_FULLSCREEN"])
 		return
 	}
+
+	for _, prop := range []xproto.Atom{prop1, prop2} {
+		if prop != xproto.AtomNone {
+			wm.applyNetWMState(ev.Window, action, prop)
+		}
+	}
 }
 
-func (wm *WindowManager) removeFullScreenEWMH(win xproto.Window) {
-	netWmState := wm.atoms["_NET_WM_STATE"]
-	// Change the window property to remove fullscreen
-	err := xproto.ChangePropertyChecked(
-		wm.conn,
-		xproto.PropModeReplace,
-		win,
-		netWmState,
-		xproto.AtomAtom,
-		32,
-		0,
-		nil,
-	).Check()
-	if err != nil {
+func (wm *WindowManager) applyNetWMState(w xproto.Window, action uint32, state xproto.Atom) {
+	win, ok := wm.windows[w]
+	if !ok {
+		return
+	}
+
+	enable := action == netWMStateAdd
+	if action == netWMStateToggle {
+		enable = !wm.hasNetWMState(w, state)
+	} else if action != netWMStateRemove && action != netWMStateAdd {
+		return
+	}
+
+	switch state {
+	case wm.atoms["_NET_WM_STATE_FULLSCREEN"]:
+		// only obey if the user wants windows to fullscreen themselves
+		if !wm.config.AutoFullscreen {
+			return
+		}
+		fmt.Println("Fullscreen request! Action:", action)
+		if enable && !win.Fullscreen {
+			wm.fullscreen(win, w)
+		} else if !enable && win.Fullscreen {
+			wm.disableFullscreen(win, w)
+		}
+		return
+	case wm.atoms["_NET_WM_STATE_HIDDEN"]:
+		// minimize and restore set the property themselves
+		if enable {
+			wm.minimize(w)
+		} else {
+			wm.restore(w)
+		}
+		return
+	case wm.atoms["_NET_WM_STATE_ABOVE"]:
+		win.Above = enable
+		if enable {
+			win.Below = false
+			wm.removeNetWMState(w, wm.atoms["_NET_WM_STATE_BELOW"])
+		}
+		wm.restack()
+	case wm.atoms["_NET_WM_STATE_BELOW"]:
+		win.Below = enable
+		if enable {
+			win.Above = false
+			wm.removeNetWMState(w, wm.atoms["_NET_WM_STATE_ABOVE"])
+		}
+		wm.restack()
+	case wm.atoms["_NET_WM_STATE_STICKY"]:
+		win.Sticky = enable
+		if enable {
+			wm.setWindowDesktop(w, allDesktops)
+		} else if mon, _ := wm.locateWindow(w); mon != nil {
+			wm.setWindowDesktop(w, uint32(mon.workspaceIndex))
+		}
+	case wm.atoms["_NET_WM_STATE_SHADED"]:
+		// there is no frame or title bar to roll up into, so a shaded window is unmapped but keeps its place
+		if win.Minimized {
+			return
+		}
+		win.Shaded = enable
+		if enable {
+			xproto.UnmapWindow(wm.conn, w)
+		} else if mon, wksp := wm.locateWindow(w); wksp != nil && wksp == mon.CurrWorkspace {
+			xproto.MapWindow(wm.conn, w)
+		}
+	case wm.atoms["_NET_WM_STATE_MODAL"],
+		wm.atoms["_NET_WM_STATE_SKIP_TASKBAR"],
+		wm.atoms["_NET_WM_STATE_SKIP_PAGER"],
+		wm.atoms["_NET_WM_STATE_DEMANDS_ATTENTION"]:
+		// these are just hints for other clients (bars, pagers), we only need to keep the property right
+	default:
+		// unsupported state, don't claim it
+		return
+	}
+
+	if enable {
+		wm.addNetWMState(w, state)
+	} else {
+		wm.removeNetWMState(w, state)
+	}
+}
+
+// adoptNetWMState reads the states a window set before it was mapped, keeps track of the ones we honour and drops the
+// ones that aren't true (yet). It reports if the window asked to start fullscreen.
+func (wm *WindowManager) adoptNetWMState(w xproto.Window) bool {
+	win, ok := wm.windows[w]
+	if !ok {
+		return false
+	}
+
+	wantsFullscreen := false
+	states := wm.getNetWMState(w)
+	kept := make([]xproto.Atom, 0, len(states))
+	for _, state := range states {
+		switch state {
+		case wm.atoms["_NET_WM_STATE_ABOVE"]:
+			win.Above = true
+		case wm.atoms["_NET_WM_STATE_BELOW"]:
+			win.Below = true
+		case wm.atoms["_NET_WM_STATE_STICKY"]:
+			win.Sticky = true
+		case wm.atoms["_NET_WM_STATE_FULLSCREEN"],
+			wm.atoms["_NET_WM_STATE_MAXIMIZED_HORZ"],
+			wm.atoms["_NET_WM_STATE_MAXIMIZED_VERT"]:
+			wantsFullscreen = true
+			continue
+		case wm.atoms["_NET_WM_STATE_HIDDEN"], wm.atoms["_NET_WM_STATE_SHADED"]:
+			continue
+		}
+		kept = append(kept, state)
+	}
+
+	if len(kept) != len(states) {
+		wm.setNetWMState(w, kept)
+	}
+	return wantsFullscreen
+}
+
+func (wm *WindowManager) hasNetWMState(win xproto.Window, state xproto.Atom) bool {
+	for _, s := range wm.getNetWMState(win) {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Stacking layers from the bottom up, windows are only ever raised and lowered within their own layer.
+const (
+	layerBelow = iota
+	layerNormal
+	layerAbove // docks and windows that want to be above
+	layerFullscreen
+)
+
+func (wm *WindowManager) layer(win *Window) int {
+	switch {
+	case win.Fullscreen:
+		return layerFullscreen
+	case win.Above:
+		return layerAbove
+	case win.Below:
+		return layerBelow
+	default:
+		return layerNormal
+	}
+}
+
+// stackingOrder is every managed window and dock from the bottom to the top.
+func (wm *WindowManager) stackingOrder() []xproto.Window {
+	order := make([]xproto.Window, 0, len(wm.stack)+len(wm.docks))
+	for layer := layerBelow; layer <= layerFullscreen; layer++ {
+		if layer == layerAbove {
+			order = append(order, wm.docks...)
+		}
+		for _, w := range wm.stack {
+			if win, ok := wm.windows[w]; ok && wm.layer(win) == layer {
+				order = append(order, w)
+			}
+		}
+	}
+	return order
+}
+
+// restack makes the X server's stacking order match ours and tells everyone about it.
+func (wm *WindowManager) restack() {
+	order := wm.stackingOrder()
+	// put each window directly above the one before it
+	for i := 1; i < len(order); i++ {
+		xproto.ConfigureWindow(
+			wm.conn,
+			order[i],
+			xproto.ConfigWindowSibling|xproto.ConfigWindowStackMode,
+			[]uint32{uint32(order[i-1]), xproto.StackModeAbove},
+		)
+	}
+	wm.setNetClientListStacking()
+}
+
+// raise puts a window on top of the other windows in its layer.
+func (wm *WindowManager) raise(w xproto.Window) {
+	if _, ok := wm.windows[w]; !ok {
 		return
 	}
+	removeID(&wm.stack, w)
+	wm.stack = append(wm.stack, w)
+	wm.restack()
+}
+
+// lower puts a window under the other windows in its layer.
+func (wm *WindowManager) lower(w xproto.Window) {
+	if _, ok := wm.windows[w]; !ok {
+		return
+	}
+	removeID(&wm.stack, w)
+	wm.stack = append([]xproto.Window{w}, wm.stack...)
+	wm.restack()
+}
+
+func (wm *WindowManager) isDock(win xproto.Window) bool {
+	prop, err := xproto.GetProperty(wm.conn, false, win, wm.atoms["_NET_WM_WINDOW_TYPE"], xproto.AtomAtom, 0, 32).
+		Reply()
+	if err != nil {
+		return false
+	}
+	for i := 0; i+4 <= len(prop.Value); i += 4 {
+		if xproto.Atom(binary.LittleEndian.Uint32(prop.Value[i:])) == wm.atoms["_NET_WM_WINDOW_TYPE_DOCK"] {
+			return true
+		}
+	}
+	return false
+}
+
+func (wm *WindowManager) addDock(win xproto.Window) {
+	for _, dock := range wm.docks {
+		if dock == win {
+			return
+		}
+	}
+	wm.docks = append(wm.docks, win)
+
+	// so we know when its struts change
+	err := xproto.ChangeWindowAttributesChecked(wm.conn, win, xproto.CwEventMask, []uint32{
+		xproto.EventMaskPropertyChange,
+	}).Check()
+	if err != nil {
+		slog.Error("Failed to set event mask on dock", "error:", err)
+	}
+	wm.updateStrut(win)
+	wm.restack()
+	wm.retile()
+}
+
+func (wm *WindowManager) removeDock(win xproto.Window) {
+	for _, dock := range wm.docks {
+		if dock == win {
+			removeID(&wm.docks, win)
+			delete(wm.struts, win)
+			wm.retile()
+			return
+		}
+	}
+}
+
+func (wm *WindowManager) setFullScreenEWMH(win xproto.Window) {
+	// only touch the fullscreen state, the window may have others set
+	wm.addNetWMState(win, wm.atoms["_NET_WM_STATE_FULLSCREEN"])
+}
+
+func (wm *WindowManager) removeFullScreenEWMH(win xproto.Window) {
+	wm.removeNetWMState(win, wm.atoms["_NET_WM_STATE_FULLSCREEN"])
 }
 
 func (wm *WindowManager) fullscreen(_ *Window, child xproto.Window) {
@@ -2021,12 +3424,7 @@ func (wm *WindowManager) fullscreen(_ *Window, child xproto.Window) {
 			wm.currMonitor.CurrWorkspace.windowList[i].Fullscreen = true
 		}
 	}
-	xproto.ConfigureWindow(
-		wm.conn,
-		child,
-		xproto.ConfigWindowStackMode,
-		[]uint32{xproto.StackModeAbove},
-	)
+	wm.raise(child)
 	attr, _ := xproto.GetGeometry(wm.conn, xproto.Drawable(child)).Reply()
 	win := wm.windows[child]
 	win.X = int(attr.X)
@@ -2140,6 +3538,17 @@ func (wm *WindowManager) switchWorkspace(workspace int) {
 		return
 	}
 
+	// sticky windows are on every workspace, so they just come along with us instead of being unmapped
+	sticky := []*Window{}
+	for _, frame := range wm.currMonitor.CurrWorkspace.windowList {
+		if frame.Sticky {
+			sticky = append(sticky, frame)
+		}
+	}
+	for _, frame := range sticky {
+		remove(&wm.currMonitor.CurrWorkspace.windowList, frame.id)
+	}
+
 	// unmap all windows in current workspace
 	for _, frame := range wm.currMonitor.CurrWorkspace.windowList {
 		xproto.UnmapWindowChecked(wm.conn, frame.id)
@@ -2151,11 +3560,22 @@ func (wm *WindowManager) switchWorkspace(workspace int) {
 
 	// map all the windows in the other workspace
 	for _, frame := range wm.currMonitor.CurrWorkspace.windowList {
+		if frame.Shaded {
+			continue
+		}
 		xproto.MapWindowChecked(wm.conn, frame.id)
 	}
+	wm.currMonitor.CurrWorkspace.windowList = append(wm.currMonitor.CurrWorkspace.windowList, sticky...)
 
 	wm.conn.Sync()
 
+	// the focused window went away with the old workspace, whatever ends up under the pointer can have focus instead
+	if attribs, err := xproto.GetWindowAttributes(wm.conn, wm.focused).Reply(); err == nil &&
+		attribs.MapState != xproto.MapStateViewable {
+		wm.unfocus()
+	}
+	wm.pointerLeftBehind = false
+
 	// update tiling
 	if !wm.currMonitor.CurrWorkspace.detachTiling {
 		if wm.currMonitor.tiling && !wm.currMonitor.CurrWorkspace.tiling {
@@ -2164,8 +3584,11 @@ func (wm *WindowManager) switchWorkspace(workspace int) {
 			wm.disableTiling()
 		}
 	}
-	wm.broadcastWorkspace(workspace)
 	wm.currMonitor.layoutIndex = wm.currMonitor.CurrWorkspace.layoutIndex
+	if len(sticky) > 0 {
+		wm.fitToLayout()
+	}
+	wm.broadcastWorkspace(workspace)
 }
 
 func (wm *WindowManager) sendWmDelete(conn *xgb.Conn, window xproto.Window) error {
@@ -2217,53 +3640,329 @@ func (wm *WindowManager) sendWmDelete(conn *xgb.Conn, window xproto.Window) erro
 }
 
 func (wm *WindowManager) onLeaveNotify(event xproto.LeaveNotifyEvent) {
-	// change border color when you leave a window
-	Col := wm.config.BorderUnactive
-
-	err := xproto.ChangeWindowAttributesChecked(
-		wm.conn,
-		event.Event,
-		xproto.CwBackPixel|xproto.CwBorderPixel,
-		[]uint32{
-			Col, // background
-			Col, // border color
-		},
-	).Check()
-	if err != nil {
-		slog.Error("Couldn't remove focus from window", "error:", err)
+	if event.Detail == xproto.NotifyDetailInferior || event.Mode != xproto.NotifyModeNormal ||
+		wm.pointerStill(event.RootX, event.RootY) {
+		return
+	}
+	// with sloppy focus the window keeps focus until another one is entered, when strictly following the mouse leaving
+	// a window for the desktop unfocuses it
+	if wm.config.FocusMode == "follow" && event.Event == wm.focused {
+		wm.unfocus()
 	}
 }
 
-func setFrameWindowType(conn *xgb.Conn, win xproto.Window) {
-	atomWindowType, _ := xproto.InternAtom(conn, true, uint16(len("_NET_WM_WINDOW_TYPE")), "_NET_WM_WINDOW_TYPE").
-		Reply()
-	atomNormal, _ := xproto.InternAtom(
-		conn,
-		true,
-		uint16(len("_NET_WM_WINDOW_TYPE_NORMAL")),
-		"_NET_WM_WINDOW_TYPE_NORMAL",
-	).
-		Reply()
+// focus gives a window input focus and the focused border, taking it away from the last focused window.
+func (wm *WindowManager) focus(w xproto.Window) {
+	prev := wm.focused
+	wm.focused = w
+	// windows passed over while cycling don't count as used until the cycle ends on one
+	if wm.cycle == nil {
+		wm.recordFocus(w)
+	}
 
-	xproto.ChangeProperty(conn,
-		xproto.PropModeReplace,
-		win,
-		atomWindowType.Atom,
-		xproto.AtomAtom,
-		32,
-		1,
-		[]byte{
-			byte(atomNormal.Atom),
-			byte(atomNormal.Atom >> 8),
-			byte(atomNormal.Atom >> 16),
-			byte(atomNormal.Atom >> 24),
-		},
-	)
+	wm.giveInput(w)
+	wm.setBorderColor(w)
+	wm.setNetActiveWindow(w)
+
+	// the user has seen it now
+	wm.removeNetWMState(w, wm.atoms["_NET_WM_STATE_DEMANDS_ATTENTION"])
+
+	if wm.config.FocusMode == "click" {
+		xproto.UngrabButton(wm.conn, xproto.ButtonIndexAny, w, xproto.ModMaskAny)
+	}
+	if prev != w {
+		wm.loseFocus(prev)
+	}
 }
 
-func (wm *WindowManager) setNetActiveWindow(win xproto.Window) {
-	atomActiveWin, _ := xproto.InternAtom(wm.conn, true, uint16(len("_NET_ACTIVE_WINDOW")), "_NET_ACTIVE_WINDOW").
-		Reply()
+// giveInput hands keyboard input to a window following the ICCCM focus models. Passive and locally active windows
+// get SetInputFocus, locally and globally active ones get WM_TAKE_FOCUS and are trusted to focus themselves, and
+// windows that take no input leave the keyboard with the root window.
+func (wm *WindowManager) giveInput(w xproto.Window) {
+	win, ok := wm.windows[w]
+	if !ok {
+		return
+	}
+
+	target := w
+	if win.NoInput {
+		target = wm.root
+	}
+	if !win.NoInput || !win.TakeFocus {
+		err := xproto.SetInputFocusChecked(wm.conn, xproto.InputFocusPointerRoot, target, xproto.TimeCurrentTime).Check()
+		if err != nil {
+			slog.Error("Couldn't set input focus", "error", err)
+		}
+	}
+
+	if win.TakeFocus {
+		t := wm.lastTime
+		if t == 0 {
+			t = xproto.TimeCurrentTime
+		}
+		ev := xproto.ClientMessageEvent{
+			Format: 32,
+			Window: w,
+			Type:   wm.atoms["WM_PROTOCOLS"],
+			Data: xproto.ClientMessageDataUnionData32New(
+				[]uint32{uint32(wm.atoms["WM_TAKE_FOCUS"]), uint32(t), 0, 0, 0},
+			),
+		}
+		err := xproto.SendEventChecked(wm.conn, false, w, xproto.EventMaskNoEvent, string(ev.Bytes())).Check()
+		if err != nil {
+			slog.Error("Couldn't send WM_TAKE_FOCUS", "error", err)
+		}
+	}
+}
+
+// unfocus gives focus back to the root window.
+func (wm *WindowManager) unfocus() {
+	prev := wm.focused
+	wm.focused = 0
+
+	err := xproto.SetInputFocusChecked(wm.conn, xproto.InputFocusPointerRoot, wm.root, xproto.TimeCurrentTime).Check()
+	if err != nil {
+		slog.Error("Couldn't set input focus", "error", err)
+	}
+	wm.setNetActiveWindow(xproto.WindowNone)
+	wm.loseFocus(prev)
+}
+
+func (wm *WindowManager) loseFocus(w xproto.Window) {
+	if _, ok := wm.windows[w]; !ok {
+		return
+	}
+	wm.setBorderColor(w)
+	if wm.config.FocusMode == "click" {
+		wm.grabClickToFocus(w)
+	}
+}
+
+// grabClickToFocus catches the first click on an unfocused window so we can focus it before passing the click on.
+func (wm *WindowManager) grabClickToFocus(w xproto.Window) {
+	xproto.GrabButton(
+		wm.conn,
+		false,
+		w,
+		xproto.EventMaskButtonPress,
+		xproto.GrabModeSync,
+		xproto.GrabModeAsync,
+		xproto.WindowNone,
+		xproto.CursorNone,
+		xproto.ButtonIndexAny,
+		xproto.ModMaskAny,
+	)
+}
+
+// keyboardFocus focuses a window picked with the keyboard and moves the pointer onto it when warp-pointer says to. If
+// the pointer stays where it is, entering other windows is ignored until it moves so focus doesn't jump back.
+func (wm *WindowManager) keyboardFocus(w xproto.Window) {
+	if _, ok := wm.windows[w]; !ok {
+		return
+	}
+	wm.focus(w)
+
+	pointer, err := xproto.QueryPointer(wm.conn, wm.root).Reply()
+	warp := true
+	switch wm.config.WarpPointer {
+	case "never":
+		warp = false
+	case "on-monitor-change":
+		mon, _ := wm.locateWindow(w)
+		warp = err != nil || mon == nil || wm.monitorAt(pointer.RootX, pointer.RootY) != mon
+	}
+	if !warp {
+		if err == nil {
+			wm.pointerLeftBehind = true
+			wm.leftBehindX, wm.leftBehindY = pointer.RootX, pointer.RootY
+		}
+		return
+	}
+	if err := wm.pointerToWindow(w); err != nil {
+		slog.Error("Couldn't move pointer to window", "error:", err)
+	}
+}
+
+// pointerStill reports if the pointer hasn't moved since it was left behind by keyboard focus, so a crossing event is
+// only a window moving under it. Once it has moved the pointer counts as being used again.
+func (wm *WindowManager) pointerStill(x, y int16) bool {
+	if !wm.pointerLeftBehind {
+		return false
+	}
+	if x == wm.leftBehindX && y == wm.leftBehindY {
+		return true
+	}
+	wm.pointerLeftBehind = false
+	return false
+}
+
+// focusCycle is an alt-tab style walk through a workspace's focus history, nothing is committed to the history until
+// the mod key is released
+type focusCycle struct {
+	windows []xproto.Window
+	index   int
+	mods    uint16
+}
+
+func (wm *WindowManager) recordFocus(w xproto.Window) {
+	removeID(&wm.focusHistory, w)
+	wm.focusHistory = append([]xproto.Window{w}, wm.focusHistory...)
+}
+
+func (wm *WindowManager) forgetFocus(w xproto.Window) {
+	if wm.focused == w {
+		wm.focused = 0
+	}
+	removeID(&wm.focusHistory, w)
+	if wm.cycle != nil {
+		for i, id := range wm.cycle.windows {
+			if id == w {
+				wm.cycle.windows = append(wm.cycle.windows[:i], wm.cycle.windows[i+1:]...)
+				if wm.cycle.index >= i && wm.cycle.index > 0 {
+					wm.cycle.index--
+				}
+				break
+			}
+		}
+	}
+}
+
+// lastFocused is the most recently focused window that doesn't have focus now, on any workspace.
+func (wm *WindowManager) lastFocused() (xproto.Window, bool) {
+	for _, w := range wm.focusHistory {
+		if _, ok := wm.windows[w]; ok && w != wm.focused {
+			return w, true
+		}
+	}
+	return 0, false
+}
+
+// workspaceHistory lists the windows shown on a workspace from most to least recently focused, windows that have never
+// had focus come last in the order they are laid out.
+func (wm *WindowManager) workspaceHistory(wksp *Workspace) []xproto.Window {
+	shown := map[xproto.Window]bool{}
+	for _, win := range wksp.windowList {
+		if !win.Shaded {
+			shown[win.id] = true
+		}
+	}
+
+	var res []xproto.Window
+	for _, w := range wm.focusHistory {
+		if shown[w] {
+			res = append(res, w)
+			delete(shown, w)
+		}
+	}
+	for _, win := range wksp.windowList {
+		if shown[win.id] {
+			res = append(res, win.id)
+		}
+	}
+	return res
+}
+
+// cycleFocus steps through the current workspace's windows in the order they were last used. The keyboard is grabbed
+// on the first step so we see the keybind's modifiers being released.
+func (wm *WindowManager) cycleFocus(step int, mods uint16) {
+	if wm.cycle == nil {
+		windows := wm.workspaceHistory(wm.currMonitor.CurrWorkspace)
+		if len(windows) < 2 {
+			return
+		}
+		grab, err := xproto.GrabKeyboard(
+			wm.conn,
+			false,
+			wm.root,
+			xproto.TimeCurrentTime,
+			xproto.GrabModeAsync,
+			xproto.GrabModeAsync,
+		).Reply()
+		if err != nil || grab.Status != xproto.GrabStatusSuccess {
+			slog.Error("Couldn't grab keyboard for focus cycling", "error:", err)
+			return
+		}
+		wm.cycle = &focusCycle{windows: windows, mods: mods}
+	}
+
+	c := wm.cycle
+	if len(c.windows) == 0 {
+		wm.endCycleFocus()
+		return
+	}
+	c.index = (c.index + step + len(c.windows)) % len(c.windows)
+	w := c.windows[c.index]
+	wm.raise(w)
+	wm.focus(w)
+}
+
+func (wm *WindowManager) endCycleFocus() {
+	xproto.UngrabKeyboard(wm.conn, xproto.TimeCurrentTime)
+	wm.cycle = nil
+	if wm.focused != 0 {
+		wm.keyboardFocus(wm.focused)
+	}
+}
+
+// setBorderColor colours a window's border for whether it is focused or wants attention.
+func (wm *WindowManager) setBorderColor(w xproto.Window) {
+	win, ok := wm.windows[w]
+	if !ok {
+		return
+	}
+
+	col := wm.config.BorderUnactive
+	if win.Urgent {
+		col = wm.config.BorderUrgent
+	}
+	if w == wm.focused {
+		col = wm.config.BorderActive
+	}
+
+	err := xproto.ChangeWindowAttributesChecked(
+		wm.conn,
+		w,
+		xproto.CwBackPixel|xproto.CwBorderPixel,
+		[]uint32{
+			col, // background
+			col, // border color
+		},
+	).Check()
+	if err != nil {
+		slog.Error("Couldn't set border color", "error:", err)
+	}
+}
+
+func setFrameWindowType(conn *xgb.Conn, win xproto.Window) {
+	atomWindowType, _ := xproto.InternAtom(conn, true, uint16(len("_NET_WM_WINDOW_TYPE")), "_NET_WM_WINDOW_TYPE").
+		Reply()
+	atomNormal, _ := xproto.InternAtom(
+		conn,
+		true,
+		uint16(len("_NET_WM_WINDOW_TYPE_NORMAL")),
+		"_NET_WM_WINDOW_TYPE_NORMAL",
+	).
+		Reply()
+
+	xproto.ChangeProperty(conn,
+		xproto.PropModeReplace,
+		win,
+		atomWindowType.Atom,
+		xproto.AtomAtom,
+		32,
+		1,
+		[]byte{
+			byte(atomNormal.Atom),
+			byte(atomNormal.Atom >> 8),
+			byte(atomNormal.Atom >> 16),
+			byte(atomNormal.Atom >> 24),
+		},
+	)
+}
+
+func (wm *WindowManager) setNetActiveWindow(win xproto.Window) {
+	atomActiveWin, _ := xproto.InternAtom(wm.conn, true, uint16(len("_NET_ACTIVE_WINDOW")), "_NET_ACTIVE_WINDOW").
+		Reply()
 
 	// Convert uint32 to []byte
 	buf := new(bytes.Buffer)
@@ -2281,56 +3980,125 @@ func (wm *WindowManager) setNetActiveWindow(win xproto.Window) {
 }
 
 func (wm *WindowManager) setNetWorkArea() {
-	atomWorkArea, err := xproto.InternAtom(wm.conn, true, uint16(len("_NET_WORKAREA")), "_NET_WORKAREA").
-		Reply()
-	if err != nil {
-		// handle error properly here
+	// the work area is the same on every workspace since it only depends on the bars, EWMH only has room for one
+	// rectangle so it is the primary monitor's work area (a box around all of them would cover a bar that is only on
+	// one monitor), GTK reads the per monitor ones from _GTK_WORKAREAS_D<n>
+	areas := make([]Space, 0, len(wm.monitors))
+	for i := range wm.monitors {
+		areas = append(areas, wm.workArea(&wm.monitors[i]))
+	}
+	if len(areas) == 0 {
 		return
 	}
+	primary := wm.workArea(wm.primaryMonitor())
 
+	desktops := len(wm.currMonitor.Workspaces)
 	buf := new(bytes.Buffer)
-
-	spaceX, spaceY, spaceWidth, spaceHeight := wm.currMonitor.TilingSpace.X, wm.currMonitor.TilingSpace.Y, wm.currMonitor.TilingSpace.Width, wm.currMonitor.TilingSpace.Height //nolint: lll
-
-	for _, wksp := range wm.currMonitor.Workspaces {
-		if !wksp.tiling {
-			_ = binary.Write(buf, binary.LittleEndian, uint32(0))
-			_ = binary.Write(buf, binary.LittleEndian, uint32(0))
-			_ = binary.Write(buf, binary.LittleEndian, uint32(wm.currMonitor.Width))
-			_ = binary.Write(buf, binary.LittleEndian, uint32(wm.currMonitor.Height))
-		} else {
-			_ = binary.Write(buf, binary.LittleEndian, uint32(spaceX))
-			_ = binary.Write(buf, binary.LittleEndian, uint32(spaceY))
-			_ = binary.Write(buf, binary.LittleEndian, uint32(spaceWidth))
-			_ = binary.Write(buf, binary.LittleEndian, uint32(spaceHeight))
-		}
+	for range desktops {
+		_ = binary.Write(buf, binary.LittleEndian, []uint32{
+			uint32(primary.X), uint32(primary.Y), uint32(primary.Width), uint32(primary.Height),
+		})
 	}
 
 	// Number of 32-bit CARDINAL values: 4 values per workspace
-	numValues := uint32(4 * len(wm.currMonitor.Workspaces))
-
-	err = xproto.ChangePropertyChecked(
+	err := xproto.ChangePropertyChecked(
 		wm.conn,
 		xproto.PropModeReplace,
 		wm.root,
-		atomWorkArea.Atom,
+		wm.atoms["_NET_WORKAREA"],
 		xproto.AtomCardinal,
 		32,
-		numValues,
+		uint32(4*desktops),
 		buf.Bytes(),
 	).Check()
 	if err != nil {
 		slog.Error("Couldn't set the work area", "error:", err)
 	}
+
+	monitorBuf := new(bytes.Buffer)
+	for _, area := range areas {
+		_ = binary.Write(monitorBuf, binary.LittleEndian, []uint32{
+			uint32(area.X), uint32(area.Y), uint32(area.Width), uint32(area.Height),
+		})
+	}
+	for i := range desktops {
+		name := "_GTK_WORKAREAS_D" + strconv.Itoa(i)
+		atom, err := xproto.InternAtom(wm.conn, false, uint16(len(name)), name).Reply()
+		if err != nil {
+			continue
+		}
+		xproto.ChangeProperty(
+			wm.conn,
+			xproto.PropModeReplace,
+			wm.root,
+			atom.Atom,
+			xproto.AtomCardinal,
+			32,
+			uint32(4*len(areas)),
+			monitorBuf.Bytes(),
+		)
+	}
+}
+
+// primaryMonitor is the monitor randr says is the primary one, or the first monitor if none is set.
+func (wm *WindowManager) primaryMonitor() *Monitor {
+	primary, err := randr.GetOutputPrimary(wm.conn, wm.root).Reply()
+	if err == nil && primary.Output != 0 {
+		info, err := randr.GetOutputInfo(wm.conn, primary.Output, xproto.TimeCurrentTime).Reply()
+		if err == nil {
+			for i := range wm.monitors {
+				if wm.monitors[i].crtc == info.Crtc {
+					return &wm.monitors[i]
+				}
+			}
+		}
+	}
+	return &wm.monitors[0]
+}
+
+// setNetDesktopGeometry publishes the size of the whole screen and the viewport of every desktop (we don't have large
+// desktops so they are all at 0,0).
+func (wm *WindowManager) setNetDesktopGeometry() {
+	geom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(wm.root)).Reply()
+	if err != nil {
+		slog.Error("Couldn't get root geometry", "error:", err)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, []uint32{uint32(geom.Width), uint32(geom.Height)})
+	xproto.ChangeProperty(
+		wm.conn,
+		xproto.PropModeReplace,
+		wm.root,
+		wm.atoms["_NET_DESKTOP_GEOMETRY"],
+		xproto.AtomCardinal,
+		32,
+		2,
+		buf.Bytes(),
+	)
+
+	desktops := len(wm.currMonitor.Workspaces)
+	xproto.ChangeProperty(
+		wm.conn,
+		xproto.PropModeReplace,
+		wm.root,
+		wm.atoms["_NET_DESKTOP_VIEWPORT"],
+		xproto.AtomCardinal,
+		32,
+		uint32(2*desktops),
+		make([]byte, 8*desktops),
+	)
 }
 
 func (wm *WindowManager) setNetClientList() {
 	atomClientList, _ := xproto.InternAtom(wm.conn, true, uint16(len("_NET_CLIENT_LIST")), "_NET_CLIENT_LIST").
 		Reply()
 
+	// in the order the windows were mapped, oldest first
 	buf := new(bytes.Buffer)
-	for _, info := range wm.windows {
-		_ = binary.Write(buf, binary.LittleEndian, info.Client)
+	for _, w := range wm.clientOrder {
+		_ = binary.Write(buf, binary.LittleEndian, wm.windows[w].Client)
 	}
 
 	xproto.ChangeProperty(wm.conn,
@@ -2339,32 +4107,43 @@ func (wm *WindowManager) setNetClientList() {
 		atomClientList.Atom,
 		xproto.AtomWindow,
 		32,
-		uint32(len(wm.windows)),
+		uint32(len(wm.clientOrder)),
+		buf.Bytes(),
+	)
+}
+
+func (wm *WindowManager) setNetClientListStacking() {
+	// bottom to top
+	buf := new(bytes.Buffer)
+	for _, w := range wm.stackingOrder() {
+		if win, ok := wm.windows[w]; ok {
+			_ = binary.Write(buf, binary.LittleEndian, win.Client)
+		}
+	}
+
+	xproto.ChangeProperty(wm.conn,
+		xproto.PropModeReplace,
+		wm.root,
+		wm.atoms["_NET_CLIENT_LIST_STACKING"],
+		xproto.AtomWindow,
+		32,
+		uint32(buf.Len()/4),
 		buf.Bytes(),
 	)
 }
 
 func (wm *WindowManager) onEnterNotify(event xproto.EnterNotifyEvent) {
-	// set focus when we enter a window and change border color
-	err := xproto.SetInputFocusChecked(wm.conn, xproto.InputFocusPointerRoot, event.Event, xproto.TimeCurrentTime).
-		Check()
-	if err != nil {
-		slog.Error("Couldn't set input focus", "error", err)
+	// moving into one of the window's own subwindows or a grab starting/ending isn't really entering it
+	if event.Detail == xproto.NotifyDetailInferior || event.Mode != xproto.NotifyModeNormal {
+		return
 	}
-	Col := wm.config.BorderActive
-	err = xproto.ChangeWindowAttributesChecked(
-		wm.conn,
-		event.Event,
-		xproto.CwBackPixel|xproto.CwBorderPixel,
-		[]uint32{
-			Col, // background
-			Col, // border color
-		},
-	).Check()
-	if err != nil {
-		slog.Error("Couldn't set focus on window", "error:", err)
+	if wm.config.FocusMode == "click" || wm.cycle != nil || wm.pointerStill(event.RootX, event.RootY) {
+		return
+	}
+	// set focus when we enter a window
+	if _, ok := wm.windows[event.Event]; ok {
+		wm.focus(event.Event)
 	}
-	wm.setNetActiveWindow(event.Event)
 }
 
 func (wm *WindowManager) findWindow(window xproto.Window) (bool, int, xproto.Window) { //nolint:unparam
@@ -2419,6 +4198,27 @@ func (wm *WindowManager) onUnmapNotify(event xproto.UnmapNotifyEvent) {
 }
 
 func (wm *WindowManager) remDestroyedWin(window xproto.Window) {
+	// minimized windows aren't in any window list, just forget about them
+	if win, ok := wm.windows[window]; ok && win.Minimized {
+		if _, wksp := wm.locateWindow(window); wksp != nil {
+			remove(&wksp.minimized, window)
+		}
+		delete(wm.windows, window)
+		removeID(&wm.clientOrder, window)
+		removeID(&wm.stack, window)
+		wm.forgetFocus(window)
+		wm.setNetClientList()
+		wm.setNetClientListStacking()
+		if win.Urgent {
+			wm.broadcastUrgency()
+		}
+		err := xproto.ChangeSaveSetChecked(wm.conn, xproto.SetModeDelete, window).Check()
+		if err != nil {
+			slog.Error("Couldn't remove window from save", "error:", err.Error())
+		}
+		return
+	}
+
 	found := false
 	for _, win := range wm.currMonitor.CurrWorkspace.windowList {
 		if win.id == window {
@@ -2426,78 +4226,963 @@ func (wm *WindowManager) remDestroyedWin(window xproto.Window) {
 			break
 		}
 	}
-	if !found {
-		fmt.Println("IN UNMAPPING COULDNT FIND WIN NOW SEARCHING")
-		ok, index, _ := wm.findWindow(window)
-		if !ok {
-			slog.Info("Couldn't unmap since window wasn't in clients")
-			fmt.Println(window)
-			return
+	if !found {
+		fmt.Println("IN UNMAPPING COULDNT FIND WIN NOW SEARCHING")
+		ok, index, _ := wm.findWindow(window)
+		if !ok {
+			slog.Info("Couldn't unmap since window wasn't in clients")
+			fmt.Println(window)
+			return
+		}
+		wm.currMonitor.CurrWorkspace = &wm.currMonitor.Workspaces[index]
+		fmt.Println("IN WORKSPACE", index, wm.currMonitor.CurrWorkspace.windowList)
+		wm.unFrame(window, false)
+		wm.currMonitor.CurrWorkspace = &wm.currMonitor.Workspaces[wm.currMonitor.workspaceIndex]
+		return
+	}
+
+	wm.unFrame(window, false)
+	wm.fitToLayout()
+}
+
+func (wm *WindowManager) unFrame(w xproto.Window, _ bool) {
+	// if it is already unmapped then no need to do it again
+	err := xproto.UnmapWindowChecked(
+		wm.conn,
+		w,
+	).Check()
+	if err != nil {
+		slog.Error("Couldn't unmap frame", "error:", err.Error())
+	}
+	// remove window and frame from current workspace record
+	remove(&wm.currMonitor.CurrWorkspace.windowList, w)
+	urgent := wm.windows[w] != nil && wm.windows[w].Urgent
+	wm.forgetFocus(w)
+	delete(wm.windows, w)
+	removeID(&wm.clientOrder, w)
+	removeID(&wm.stack, w)
+	wm.setNetClientList()
+	wm.setNetClientListStacking()
+	if urgent {
+		wm.broadcastUrgency()
+	}
+
+	// delete window from x11 set
+	err = xproto.ChangeSaveSetChecked(
+		wm.conn,
+		xproto.SetModeDelete,
+		w,
+	).Check()
+	if err != nil {
+		slog.Error("Couldn't remove window from save", "error:", err.Error())
+	}
+
+	// destroy frame
+	err = xproto.DestroyWindowChecked(
+		wm.conn,
+		w,
+	).Check()
+	if err != nil {
+		slog.Error("Couldn't destroy frame", "error:", err.Error())
+		return
+	}
+
+	slog.Info("Unmapped", "window", w)
+}
+
+// directions for the geometric focus, swap and move roles.
+const (
+	dirLeft = iota
+	dirRight
+	dirUp
+	dirDown
+)
+
+var directions = map[string]int{
+	"left":  dirLeft,
+	"right": dirRight,
+	"up":    dirUp,
+	"down":  dirDown,
+}
+
+// nearestInDirection picks the space closest to from in a direction, going by their centres. Being off to the side
+// counts double so the window straight across wins over a closer one diagonally. It returns -1 if nothing is that way.
+func nearestInDirection(from Space, dir int, spaces []Space) int {
+	fx, fy := from.X+from.Width/2, from.Y+from.Height/2
+	best, bestScore := -1, 0
+	for i, sp := range spaces {
+		dx := sp.X + sp.Width/2 - fx
+		dy := sp.Y + sp.Height/2 - fy
+		var along, across int
+		switch dir {
+		case dirLeft:
+			along, across = -dx, dy
+		case dirRight:
+			along, across = dx, dy
+		case dirUp:
+			along, across = -dy, dx
+		case dirDown:
+			along, across = dy, dx
+		}
+		if along <= 0 {
+			continue
+		}
+		if across < 0 {
+			across = -across
+		}
+		score := along + 2*across
+		if best == -1 || score < bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// monitorInDirection is the monitor next to mon in a direction, or nil at the edge of the screen.
+func (wm *WindowManager) monitorInDirection(mon *Monitor, dir int) *Monitor {
+	var spaces []Space
+	var mons []*Monitor
+	for i := range wm.monitors {
+		m := &wm.monitors[i]
+		if m.X == mon.X && m.Y == mon.Y {
+			continue
+		}
+		spaces = append(spaces, Space{X: int(m.X), Y: int(m.Y), Width: int(m.Width), Height: int(m.Height)})
+		mons = append(mons, m)
+	}
+	from := Space{X: int(mon.X), Y: int(mon.Y), Width: int(mon.Width), Height: int(mon.Height)}
+	if i := nearestInDirection(from, dir, spaces); i != -1 {
+		return mons[i]
+	}
+	return nil
+}
+
+// windowSpace is where a window is on the screen right now.
+func (wm *WindowManager) windowSpace(w xproto.Window) (Space, bool) {
+	geom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(w)).Reply()
+	if err != nil {
+		return Space{}, false
+	}
+	return Space{X: int(geom.X), Y: int(geom.Y), Width: int(geom.Width), Height: int(geom.Height)}, true
+}
+
+// windowInDirection finds the nearest shown window in a direction from w (or from the pointer if w isn't managed),
+// looking on the monitor next door when there is nothing that way on this one.
+func (wm *WindowManager) windowInDirection(w xproto.Window, dir int) (xproto.Window, *Monitor) {
+	mon, _ := wm.locateWindow(w)
+	from, ok := wm.windowSpace(w)
+	if mon == nil || !ok {
+		pointer, err := xproto.QueryPointer(wm.conn, wm.root).Reply()
+		if err != nil {
+			return 0, nil
+		}
+		from = Space{X: int(pointer.RootX), Y: int(pointer.RootY)}
+		mon = wm.monitorAt(pointer.RootX, pointer.RootY)
+		if mon == nil {
+			return 0, nil
+		}
+	}
+
+	for mon != nil {
+		var spaces []Space
+		var wins []xproto.Window
+		for _, win := range mon.CurrWorkspace.windowList {
+			if win.id == w || win.Shaded {
+				continue
+			}
+			if sp, ok := wm.windowSpace(win.id); ok {
+				spaces = append(spaces, sp)
+				wins = append(wins, win.id)
+			}
+		}
+		if i := nearestInDirection(from, dir, spaces); i != -1 {
+			return wins[i], mon
+		}
+		mon = wm.monitorInDirection(mon, dir)
+		if mon != nil && len(mon.CurrWorkspace.windowList) == 0 {
+			return 0, mon
+		}
+	}
+	return 0, nil
+}
+
+func (wm *WindowManager) monitorAt(x, y int16) *Monitor {
+	for i := range wm.monitors {
+		mon := &wm.monitors[i]
+		if x >= mon.X && x <= mon.X+int16(mon.Width) && y >= mon.Y && y <= mon.Y+int16(mon.Height) {
+			return mon
+		}
+	}
+	return nil
+}
+
+// focusDirection focuses the nearest window in a direction, moving over to the next monitor at the edge. An empty
+// monitor just gets the pointer so the next window opens there.
+func (wm *WindowManager) focusDirection(w xproto.Window, dir int) {
+	target, mon := wm.windowInDirection(w, dir)
+	if mon == nil {
+		return
+	}
+	wm.currMonitor = mon
+	if target == 0 {
+		if wm.config.WarpPointer != "never" {
+			xproto.WarpPointer(wm.conn, 0, wm.root, 0, 0, 0, 0,
+				mon.X+int16(mon.Width/2), mon.Y+int16(mon.Height/2))
+		}
+		return
+	}
+	if !mon.CurrWorkspace.tiling {
+		wm.raise(target)
+	}
+	wm.keyboardFocus(target)
+}
+
+// swapDirection swaps a window with the nearest one in a direction, in tiling they swap places in the layout and when
+// floating they swap positions and sizes. Windows on different monitors swap monitors too.
+func (wm *WindowManager) swapDirection(w xproto.Window, dir int) {
+	win, ok := wm.windows[w]
+	if !ok || win.Fullscreen {
+		return
+	}
+	target, tmon := wm.windowInDirection(w, dir)
+	if target == 0 || wm.windows[target].Fullscreen {
+		return
+	}
+	mon, wksp := wm.locateWindow(w)
+	_, twksp := wm.locateWindow(target)
+
+	if wksp == twksp {
+		if wksp.tiling {
+			swapWindowsID(&wksp.windowList, w, target)
+			wm.fitMonitor(mon)
+		} else {
+			wm.swapGeometry(w, target)
+		}
+	} else {
+		// trade places in each other's window lists so the layouts stay in the same order
+		for i, other := range wksp.windowList {
+			if other.id == w {
+				wksp.windowList[i] = wm.windows[target]
+			}
+		}
+		for i, other := range twksp.windowList {
+			if other.id == target {
+				twksp.windowList[i] = win
+			}
+		}
+		wm.setWindowDesktop(w, uint32(tmon.workspaceIndex))
+		wm.setWindowDesktop(target, uint32(mon.workspaceIndex))
+		wm.swapGeometry(w, target)
+		wm.fitMonitor(mon)
+		wm.fitMonitor(tmon)
+	}
+
+	wm.currMonitor = tmon
+	wm.keyboardFocus(w)
+}
+
+func (wm *WindowManager) swapGeometry(a, b xproto.Window) {
+	as, ok := wm.windowSpace(a)
+	if !ok {
+		return
+	}
+	bs, ok := wm.windowSpace(b)
+	if !ok {
+		return
+	}
+	wm.configureWindow(a, bs.X, bs.Y, bs.Width, bs.Height)
+	wm.configureWindow(b, as.X, as.Y, as.Width, as.Height)
+}
+
+// moveDirection moves a window one step in a direction. In tiling that is swapping with the window next to it, when
+// floating the window goes to the edge of the work area. Either way once it can't go any further it moves over to the
+// next monitor.
+func (wm *WindowManager) moveDirection(w xproto.Window, dir int) {
+	win, ok := wm.windows[w]
+	if !ok || win.Fullscreen {
+		return
+	}
+	mon, wksp := wm.locateWindow(w)
+	if mon == nil {
+		return
+	}
+
+	if wksp.tiling {
+		if target, tmon := wm.windowInDirection(w, dir); target != 0 && tmon == mon {
+			wm.swapDirection(w, dir)
+			return
+		}
+	} else if sp, ok := wm.windowSpace(w); ok {
+		area := wm.workArea(mon)
+		x, y := sp.X, sp.Y
+		// the border sits outside the window
+		bw := int(wm.config.BorderWidth) * 2
+		switch dir {
+		case dirLeft:
+			x = area.X
+		case dirRight:
+			x = area.X + area.Width - sp.Width - bw
+		case dirUp:
+			y = area.Y
+		case dirDown:
+			y = area.Y + area.Height - sp.Height - bw
+		}
+		if x != sp.X || y != sp.Y {
+			wm.configureWindow(w, x, y, sp.Width, sp.Height)
+			return
+		}
+	}
+
+	if next := wm.monitorInDirection(mon, dir); next != nil {
+		wm.moveWindowToMonitor(w, next)
+	}
+}
+
+// moveWindowToMonitor puts a window on the workspace shown on another monitor, keeping where it was on its old
+// monitor when floating.
+func (wm *WindowManager) moveWindowToMonitor(w xproto.Window, to *Monitor) {
+	win := wm.windows[w]
+	from, wksp := wm.locateWindow(w)
+	if from == nil || from == to {
+		return
+	}
+	remove(&wksp.windowList, w)
+	to.CurrWorkspace.windowList = append(to.CurrWorkspace.windowList, win)
+	wm.setWindowDesktop(w, uint32(to.workspaceIndex))
+
+	if sp, ok := wm.windowSpace(w); ok {
+		x := int(to.X) + min(sp.X-int(from.X), max(int(to.Width)-sp.Width, 0))
+		y := int(to.Y) + min(sp.Y-int(from.Y), max(int(to.Height)-sp.Height, 0))
+		wm.configureWindow(w, x, y, sp.Width, sp.Height)
+	}
+
+	wm.fitMonitor(from)
+	wm.fitMonitor(to)
+	wm.currMonitor = to
+	wm.broadcastWorkspaceCount()
+	if win.Urgent {
+		wm.broadcastUrgency()
+	}
+	wm.keyboardFocus(w)
+}
+
+func (wm *WindowManager) setWindowDesktop(win xproto.Window, desktop uint32) {
+	atomWmDesktop, _ := xproto.InternAtom(wm.conn, true, uint16(len("_NET_WM_DESKTOP")), "_NET_WM_DESKTOP").
+		Reply()
+
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, desktop)
+
+	xproto.ChangeProperty(wm.conn,
+		xproto.PropModeReplace,
+		win,                 // client window
+		atomWmDesktop.Atom,  // _NET_WM_DESKTOP
+		xproto.AtomCardinal, // CARDINAL
+		32,
+		1,
+		buf.Bytes(),
+	)
+}
+
+// locateWindow finds the monitor and workspace a window belongs to (minimized or not), searching every monitor.
+func (wm *WindowManager) locateWindow(w xproto.Window) (*Monitor, *Workspace) {
+	for i := range wm.monitors {
+		mon := &wm.monitors[i]
+		for j := range mon.Workspaces {
+			wksp := &mon.Workspaces[j]
+			for _, win := range wksp.windowList {
+				if win.id == w {
+					return mon, wksp
+				}
+			}
+			for _, win := range wksp.minimized {
+				if win.id == w {
+					return mon, wksp
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// fitMonitor re-tiles the shown workspace of a monitor which might not be the current one.
+func (wm *WindowManager) fitMonitor(mon *Monitor) {
+	cm := wm.currMonitor
+	wm.currMonitor = mon
+	wm.fitToLayout()
+	wm.currMonitor = cm
+}
+
+func (wm *WindowManager) minimize(w xproto.Window) {
+	mon, wksp := wm.locateWindow(w)
+	if wksp == nil {
+		return
+	}
+
+	var win *Window
+	for _, window := range wksp.windowList {
+		if window.id == w {
+			win = window
+		}
+	}
+	if win == nil {
+		// already minimized
+		return
+	}
+
+	// take it out of tiling but keep it in wm.windows so it stays in the client list
+	remove(&wksp.windowList, w)
+	win.Minimized = true
+	wksp.minimized = append(wksp.minimized, win)
+
+	err := xproto.UnmapWindowChecked(wm.conn, w).Check()
+	if err != nil {
+		slog.Error("Couldn't unmap minimized window", "error:", err)
+	}
+	wm.setWMState(w, wmStateIconic)
+	wm.addNetWMState(w, wm.atoms["_NET_WM_STATE_HIDDEN"])
+
+	if wksp == mon.CurrWorkspace {
+		wm.fitMonitor(mon)
+	}
+	wm.setNetClientList()
+
+	// focus can't stay on a hidden window, give it to the window used before it
+	if w == wm.focused {
+		if next := wm.workspaceHistory(wksp); wksp == mon.CurrWorkspace && len(next) > 0 {
+			wm.keyboardFocus(next[0])
+		} else {
+			wm.unfocus()
+		}
+	}
+}
+
+func (wm *WindowManager) restore(w xproto.Window) {
+	mon, wksp := wm.locateWindow(w)
+	win, ok := wm.windows[w]
+	if wksp == nil || !ok || !win.Minimized {
+		return
+	}
+
+	remove(&wksp.minimized, w)
+	win.Minimized = false
+	wksp.windowList = append(wksp.windowList, win)
+
+	wm.setWMState(w, wmStateNormal)
+	wm.removeNetWMState(w, wm.atoms["_NET_WM_STATE_HIDDEN"])
+
+	// if the workspace isn't shown it will be mapped when it is switched to
+	if wksp == mon.CurrWorkspace {
+		err := xproto.MapWindowChecked(wm.conn, w).Check()
+		if err != nil {
+			slog.Error("Couldn't map restored window", "error:", err)
+		}
+		wm.raise(w)
+		wm.fitMonitor(mon)
+	}
+	wm.setNetClientList()
+}
+
+// restoreMenu lists the minimized windows of the current workspace in restore-menu, a dmenu style command that reads
+// lines and prints the one picked, and restores the window that was picked. The menu runs in the background so the
+// answer is sent back to the event loop as a client message.
+func (wm *WindowManager) restoreMenu() {
+	wksp := wm.currMonitor.CurrWorkspace
+	if len(wksp.minimized) == 0 {
+		return
+	}
+	args, err := shellwords.NewParser().Parse(wm.config.RestoreMenu)
+	if err != nil || len(args) == 0 {
+		slog.Error("Couldn't parse restore-menu", "error:", err)
+		return
+	}
+
+	// most recently minimized first, numbered so windows with the same title can be told apart
+	var menu strings.Builder
+	ids := make([]xproto.Window, 0, len(wksp.minimized))
+	for i := len(wksp.minimized) - 1; i >= 0; i-- {
+		win := wksp.minimized[i]
+		// windows without a title go by their class
+		title := strings.ReplaceAll(cmp.Or(win.Title, win.Class), "\n", " ")
+		if title == "" {
+			title = "window " + strconv.Itoa(int(win.id))
+		}
+		ids = append(ids, win.id)
+		fmt.Fprintf(&menu, "%d: %s\n", len(ids), title)
+	}
+
+	checkWin, restoreAtom := wm.checkWin, wm.atoms["_DOWM_RESTORE"]
+	go func() {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(menu.String())
+		out, err := cmd.Output()
+		if err != nil {
+			// closing the menu without picking anything counts as an error too
+			return
+		}
+		n, err := strconv.Atoi(strings.SplitN(strings.TrimSpace(string(out)), ":", 2)[0])
+		if err != nil || n < 1 || n > len(ids) {
+			return
+		}
+		ev := xproto.ClientMessageEvent{
+			Format: 32,
+			Window: checkWin,
+			Type:   restoreAtom,
+			Data:   xproto.ClientMessageDataUnionData32New([]uint32{uint32(ids[n-1]), 0, 0, 0, 0}),
+		}
+		xproto.SendEvent(wm.conn, false, checkWin, xproto.EventMaskNoEvent, string(ev.Bytes()))
+	}()
+}
+
+// _NET_ACTIVE_WINDOW source indication for pagers and taskbars.
+const activateSourcePager = 2
+
+// onActivateRequest decides if a window asking to be activated gets focus or just gets marked as wanting attention,
+// requests from pagers/taskbars are the user clicking on something so they are always followed.
+func (wm *WindowManager) onActivateRequest(w xproto.Window, source uint32) {
+	mon, wksp := wm.locateWindow(w)
+	if wksp == nil {
+		return
+	}
+	visible := wksp == mon.CurrWorkspace && !wm.windows[w].Minimized
+
+	policy := wm.config.FocusOnActivate
+	if source == activateSourcePager {
+		policy = "focus"
+	}
+
+	switch policy {
+	case "none":
+		return
+	case "urgent":
+		wm.addNetWMState(w, wm.atoms["_NET_WM_STATE_DEMANDS_ATTENTION"])
+	case "focus":
+		wm.activateWindow(w)
+	default: // smart
+		if visible {
+			wm.activateWindow(w)
+		} else {
+			wm.addNetWMState(w, wm.atoms["_NET_WM_STATE_DEMANDS_ATTENTION"])
+		}
+	}
+}
+
+// activateWindow brings a window into view, switching to its monitor and workspace (and restoring it if it was
+// minimized), then raises and focuses it.
+func (wm *WindowManager) activateWindow(w xproto.Window) {
+	win, ok := wm.windows[w]
+	if !ok {
+		return
+	}
+	if win.Minimized {
+		wm.restore(w)
+	}
+
+	mon, wksp := wm.locateWindow(w)
+	if wksp == nil {
+		return
+	}
+	wm.currMonitor = mon
+	for i := range mon.Workspaces {
+		if &mon.Workspaces[i] == wksp {
+			wm.switchWorkspace(i)
+			break
+		}
+	}
+
+	wm.raise(w)
+	wm.keyboardFocus(w)
+}
+
+// registerPropertyHandlers sets up what happens when a client changes one of its properties, anything that needs to
+// stay in sync with a client property should add itself here.
+func (wm *WindowManager) registerPropertyHandlers() {
+	wm.onProperty(wm.updateTitle, xproto.AtomWmName, wm.atoms["_NET_WM_NAME"])
+	wm.onProperty(wm.updateClass, xproto.AtomWmClass)
+	wm.onProperty(wm.updateSizeHints, xproto.AtomWmNormalHints)
+	wm.onProperty(func(win *Window) { wm.updateUrgency(win.id) }, xproto.AtomWmHints, wm.atoms["_NET_WM_STATE"])
+	wm.onProperty(wm.updateInputHint, xproto.AtomWmHints)
+	wm.onProperty(wm.updateProtocols, wm.atoms["WM_PROTOCOLS"])
+}
+
+// propertyHandler is something to run when any of a set of client properties changes.
+type propertyHandler struct {
+	atoms  []xproto.Atom
+	handle func(win *Window)
+}
+
+func (wm *WindowManager) onProperty(handle func(win *Window), atoms ...xproto.Atom) {
+	wm.propertyHandlers = append(wm.propertyHandlers, propertyHandler{atoms: atoms, handle: handle})
+}
+
+// onPropertyNotify dispatches a property change on a managed window to everything that wants to know about it.
+func (wm *WindowManager) onPropertyNotify(ev xproto.PropertyNotifyEvent) {
+	if ev.Atom == wm.atoms["_NET_WM_STRUT_PARTIAL"] || ev.Atom == wm.atoms["_NET_WM_STRUT"] {
+		for _, dock := range wm.docks {
+			if dock == ev.Window {
+				wm.updateStrut(dock)
+				wm.retile()
+			}
+		}
+	}
+
+	win, ok := wm.windows[ev.Window]
+	if !ok {
+		return
+	}
+	for _, handler := range wm.propertyHandlers {
+		if slices.Contains(handler.atoms, ev.Atom) {
+			handler.handle(win)
+		}
+	}
+}
+
+// refreshProperties runs every property handler once, for when we start managing a window.
+func (wm *WindowManager) refreshProperties(win *Window) {
+	for _, handler := range wm.propertyHandlers {
+		handler.handle(win)
+	}
+}
+
+func (wm *WindowManager) updateTitle(win *Window) {
+	// _NET_WM_NAME is UTF-8 so prefer it over the old WM_NAME
+	for _, atom := range []xproto.Atom{wm.atoms["_NET_WM_NAME"], xproto.AtomWmName} {
+		prop, err := xproto.GetProperty(wm.conn, false, win.id, atom, xproto.GetPropertyTypeAny, 0, 1024).Reply()
+		if err == nil && prop.Format == 8 && len(prop.Value) > 0 {
+			win.Title = string(prop.Value)
+			return
+		}
+	}
+	win.Title = ""
+}
+
+func (wm *WindowManager) updateClass(win *Window) {
+	win.Class, win.Instance = "", ""
+	prop, err := xproto.GetProperty(wm.conn, false, win.id, xproto.AtomWmClass, xproto.AtomString, 0, 1024).Reply()
+	if err != nil || prop.Format != 8 {
+		return
+	}
+
+	// WM_CLASS is the instance then the class, both null terminated
+	parts := bytes.Split(bytes.TrimRight(prop.Value, "\x00"), []byte{0})
+	win.Instance = string(parts[0])
+	if len(parts) > 1 {
+		win.Class = string(parts[1])
+	}
+}
+
+// WM_NORMAL_HINTS flags we care about.
+const (
+	normalHintsMinSize   = 1 << 4
+	normalHintsMaxSize   = 1 << 5
+	normalHintsResizeInc = 1 << 6
+	normalHintsBaseSize  = 1 << 8
+)
+
+func (wm *WindowManager) updateSizeHints(win *Window) {
+	prop, err := xproto.GetProperty(wm.conn, false, win.id, xproto.AtomWmNormalHints, xproto.AtomWmSizeHints, 0, 18).
+		Reply()
+	if err != nil || prop.Format != 32 || len(prop.Value) < 18*4 {
+		win.SizeHints = SizeHints{}
+		return
+	}
+
+	field := func(i int) int {
+		return int(int32(binary.LittleEndian.Uint32(prop.Value[i*4:])))
+	}
+	flags := field(0)
+	hints := SizeHints{}
+	if flags&normalHintsMinSize != 0 {
+		hints.MinWidth, hints.MinHeight = field(5), field(6)
+	}
+	if flags&normalHintsMaxSize != 0 {
+		hints.MaxWidth, hints.MaxHeight = field(7), field(8)
+	}
+	if flags&normalHintsResizeInc != 0 {
+		hints.WidthInc, hints.HeightInc = field(9), field(10)
+	}
+	if flags&normalHintsBaseSize != 0 {
+		hints.BaseWidth, hints.BaseHeight = field(15), field(16)
+	} else {
+		// ICCCM says to use the minimum size when there's no base size
+		hints.BaseWidth, hints.BaseHeight = hints.MinWidth, hints.MinHeight
+	}
+	win.SizeHints = hints
+}
+
+// WM_HINTS flags, InputHint says the input field is set and XUrgencyHint is a window wanting the user's attention.
+const (
+	wmHintsInput   = 1 << 0
+	wmHintsUrgency = 1 << 8
+)
+
+// updateInputHint reads the WM_HINTS input field, which says if the window wants focus given to it.
+func (wm *WindowManager) updateInputHint(win *Window) {
+	// without the input flag set the window is assumed to want input
+	win.NoInput = false
+	hints, err := xproto.GetProperty(wm.conn, false, win.id, xproto.AtomWmHints, xproto.AtomWmHints, 0, 9).Reply()
+	if err != nil || len(hints.Value) < 8 {
+		return
+	}
+	if binary.LittleEndian.Uint32(hints.Value)&wmHintsInput != 0 {
+		win.NoInput = binary.LittleEndian.Uint32(hints.Value[4:]) == 0
+	}
+}
+
+// updateProtocols checks WM_PROTOCOLS for WM_TAKE_FOCUS, windows with it are told when they get focus.
+func (wm *WindowManager) updateProtocols(win *Window) {
+	win.TakeFocus = false
+	prop, err := xproto.GetProperty(wm.conn, false, win.id, wm.atoms["WM_PROTOCOLS"], xproto.AtomAtom, 0, 32).Reply()
+	if err != nil || prop.Format != 32 {
+		return
+	}
+	for i := range int(prop.ValueLen) {
+		if xproto.Atom(xgb.Get32(prop.Value[i*4:])) == wm.atoms["WM_TAKE_FOCUS"] {
+			win.TakeFocus = true
+		}
+	}
+}
+
+// updateUrgency works out if a window wants attention, from either its WM_HINTS urgency or
+// _NET_WM_STATE_DEMANDS_ATTENTION, colours its border and lets bars know which workspaces have urgent windows.
+func (wm *WindowManager) updateUrgency(w xproto.Window) {
+	win, ok := wm.windows[w]
+	if !ok {
+		return
+	}
+
+	urgent := wm.hasNetWMState(w, wm.atoms["_NET_WM_STATE_DEMANDS_ATTENTION"])
+	hints, err := xproto.GetProperty(wm.conn, false, w, xproto.AtomWmHints, xproto.AtomWmHints, 0, 9).Reply()
+	if err == nil && len(hints.Value) >= 4 && binary.LittleEndian.Uint32(hints.Value)&wmHintsUrgency != 0 {
+		urgent = true
+	}
+	if urgent == win.Urgent {
+		return
+	}
+	win.Urgent = urgent
+
+	// the focused window keeps its focused colour
+	wm.setBorderColor(w)
+	wm.broadcastUrgency()
+}
+
+// broadcastUrgency sets _DOWM_URGENT_WORKSPACES on the root window to the indexes of workspaces (on any monitor) that
+// have a window wanting attention, so bars can highlight them.
+func (wm *WindowManager) broadcastUrgency() {
+	buf := new(bytes.Buffer)
+	count := 0
+	for i := range wm.currMonitor.Workspaces {
+		urgent := false
+		for _, mon := range wm.monitors {
+			if i >= len(mon.Workspaces) {
+				continue
+			}
+			wksp := mon.Workspaces[i]
+			for _, win := range append(append([]*Window{}, wksp.windowList...), wksp.minimized...) {
+				if win.Urgent {
+					urgent = true
+				}
+			}
+		}
+		if urgent {
+			_ = binary.Write(buf, binary.LittleEndian, uint32(i))
+			count++
+		}
+	}
+
+	err := xproto.ChangePropertyChecked(
+		wm.conn,
+		xproto.PropModeReplace,
+		wm.root,
+		wm.atoms["_DOWM_URGENT_WORKSPACES"],
+		xproto.AtomCardinal,
+		32,
+		uint32(count),
+		buf.Bytes(),
+	).Check()
+	if err != nil {
+		slog.Error("Couldn't set _DOWM_URGENT_WORKSPACES", "error:", err)
+	}
+}
+
+// firstUrgent finds a window wanting attention, looking at the current monitor first.
+func (wm *WindowManager) firstUrgent() (xproto.Window, bool) {
+	monitors := []*Monitor{wm.currMonitor}
+	for i := range wm.monitors {
+		if &wm.monitors[i] != wm.currMonitor {
+			monitors = append(monitors, &wm.monitors[i])
 		}
-		wm.currMonitor.CurrWorkspace = &wm.currMonitor.Workspaces[index]
-		fmt.Println("IN WORKSPACE", index, wm.currMonitor.CurrWorkspace.windowList)
-		wm.unFrame(window, false)
-		wm.currMonitor.CurrWorkspace = &wm.currMonitor.Workspaces[wm.currMonitor.workspaceIndex]
-		return
 	}
 
-	wm.unFrame(window, false)
-	wm.fitToLayout()
+	for _, mon := range monitors {
+		for _, wksp := range mon.Workspaces {
+			for _, win := range append(append([]*Window{}, wksp.windowList...), wksp.minimized...) {
+				if win.Urgent {
+					return win.id, true
+				}
+			}
+		}
+	}
+	return 0, false
 }
 
-func (wm *WindowManager) unFrame(w xproto.Window, _ bool) {
-	// if it is already unmapped then no need to do it again
-	err := xproto.UnmapWindowChecked(
+func (wm *WindowManager) setWMState(win xproto.Window, state uint32) {
+	// ICCCM WM_STATE is the state followed by the icon window (we don't use icon windows)
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint32(data, state)
+	binary.LittleEndian.PutUint32(data[4:], uint32(xproto.WindowNone))
+
+	err := xproto.ChangePropertyChecked(
 		wm.conn,
-		w,
+		xproto.PropModeReplace,
+		win,
+		wm.atoms["WM_STATE"],
+		wm.atoms["WM_STATE"],
+		32,
+		2,
+		data,
 	).Check()
 	if err != nil {
-		slog.Error("Couldn't unmap frame", "error:", err.Error())
+		slog.Error("Couldn't set WM_STATE", "error:", err)
 	}
-	// remove window and frame from current workspace record
-	remove(&wm.currMonitor.CurrWorkspace.windowList, w)
-	delete(wm.windows, w)
-	wm.setNetClientList()
+}
 
-	// delete window from x11 set
-	err = xproto.ChangeSaveSetChecked(
-		wm.conn,
-		xproto.SetModeDelete,
-		w,
-	).Check()
+func (wm *WindowManager) getNetWMState(win xproto.Window) []xproto.Atom {
+	prop, err := xproto.GetProperty(wm.conn, false, win, wm.atoms["_NET_WM_STATE"], xproto.AtomAtom, 0, 1024).
+		Reply()
 	if err != nil {
-		slog.Error("Couldn't remove window from save", "error:", err.Error())
+		return nil
 	}
 
-	// destroy frame
-	err = xproto.DestroyWindowChecked(
+	states := make([]xproto.Atom, 0, len(prop.Value)/4)
+	for i := 0; i+4 <= len(prop.Value); i += 4 {
+		states = append(states, xproto.Atom(binary.LittleEndian.Uint32(prop.Value[i:])))
+	}
+	return states
+}
+
+func (wm *WindowManager) setNetWMState(win xproto.Window, states []xproto.Atom) {
+	data := make([]byte, 4*len(states))
+	for i, state := range states {
+		binary.LittleEndian.PutUint32(data[i*4:], uint32(state))
+	}
+
+	err := xproto.ChangePropertyChecked(
 		wm.conn,
-		w,
+		xproto.PropModeReplace,
+		win,
+		wm.atoms["_NET_WM_STATE"],
+		xproto.AtomAtom,
+		32,
+		uint32(len(states)),
+		data,
 	).Check()
 	if err != nil {
-		slog.Error("Couldn't destroy frame", "error:", err.Error())
-		return
+		slog.Error("Couldn't set _NET_WM_STATE", "error:", err)
 	}
+}
 
-	slog.Info("Unmapped", "window", w)
+// addNetWMState adds a single state to _NET_WM_STATE, leaving the rest of the states alone.
+func (wm *WindowManager) addNetWMState(win xproto.Window, state xproto.Atom) {
+	states := wm.getNetWMState(win)
+	for _, s := range states {
+		if s == state {
+			return
+		}
+	}
+	wm.setNetWMState(win, append(states, state))
 }
 
-func (wm *WindowManager) setWindowDesktop(win xproto.Window, desktop uint32) {
-	atomWmDesktop, _ := xproto.InternAtom(wm.conn, true, uint16(len("_NET_WM_DESKTOP")), "_NET_WM_DESKTOP").
+// removeNetWMState removes a single state from _NET_WM_STATE, leaving the rest of the states alone.
+func (wm *WindowManager) removeNetWMState(win xproto.Window, state xproto.Atom) {
+	states := wm.getNetWMState(win)
+	kept := states[:0]
+	for _, s := range states {
+		if s != state {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) != len(states) {
+		wm.setNetWMState(win, kept)
+	}
+}
+
+// _NET_WM_DESKTOP value meaning the window is on every desktop.
+const allDesktops = 0xFFFFFFFF
+
+func (wm *WindowManager) getWindowDesktop(win xproto.Window) (uint32, bool) {
+	prop, err := xproto.GetProperty(wm.conn, false, win, wm.atoms["_NET_WM_DESKTOP"], xproto.AtomCardinal, 0, 1).
 		Reply()
+	if err != nil || prop.Format != 32 || len(prop.Value) < 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(prop.Value), true
+}
 
-	buf := new(bytes.Buffer)
-	_ = binary.Write(buf, binary.LittleEndian, desktop)
+// monitorOfWindow finds the monitor the middle of a window is on.
+func (wm *WindowManager) monitorOfWindow(win xproto.Window) *Monitor {
+	geom, err := xproto.GetGeometry(wm.conn, xproto.Drawable(win)).Reply()
+	if err != nil {
+		return nil
+	}
+	x := int(geom.X) + int(geom.Width)/2
+	y := int(geom.Y) + int(geom.Height)/2
+	for i, mon := range wm.monitors {
+		if x >= int(mon.X) && x < int(mon.X)+int(mon.Width) && y >= int(mon.Y) && y < int(mon.Y)+int(mon.Height) {
+			return &wm.monitors[i]
+		}
+	}
+	return nil
+}
 
-	xproto.ChangeProperty(wm.conn,
-		xproto.PropModeReplace,
-		win,                 // client window
-		atomWmDesktop.Atom,  // _NET_WM_DESKTOP
-		xproto.AtomCardinal, // CARDINAL
-		32,
-		1,
-		buf.Bytes(),
-	)
+// moveWindowToWorkspace moves a window to another workspace on the same monitor without switching to it.
+func (wm *WindowManager) moveWindowToWorkspace(w xproto.Window, desktop uint32) {
+	win, ok := wm.windows[w]
+	if !ok {
+		return
+	}
+	if desktop == allDesktops {
+		wm.applyNetWMState(w, netWMStateAdd, wm.atoms["_NET_WM_STATE_STICKY"])
+		return
+	}
+
+	mon, from := wm.locateWindow(w)
+	if from == nil || int(desktop) >= len(mon.Workspaces) {
+		return
+	}
+	to := &mon.Workspaces[desktop]
+	if win.Sticky {
+		wm.applyNetWMState(w, netWMStateRemove, wm.atoms["_NET_WM_STATE_STICKY"])
+	}
+	wm.setWindowDesktop(w, desktop)
+	if from == to {
+		return
+	}
+
+	if win.Minimized {
+		remove(&from.minimized, w)
+		to.minimized = append(to.minimized, win)
+		if win.Urgent {
+			wm.broadcastUrgency()
+		}
+		return
+	}
+	remove(&from.windowList, w)
+	to.windowList = append(to.windowList, win)
+
+	if from == mon.CurrWorkspace {
+		xproto.UnmapWindow(wm.conn, w)
+		wm.fitMonitor(mon)
+	} else if to == mon.CurrWorkspace {
+		if !win.Shaded {
+			xproto.MapWindow(wm.conn, w)
+		}
+		wm.fitMonitor(mon)
+	}
+	wm.broadcastWorkspaceCount()
+	if win.Urgent {
+		wm.broadcastUrgency()
+	}
 }
 
 func shouldIgnoreWindow(conn *xgb.Conn, win xproto.Window) bool {
@@ -2610,42 +5295,13 @@ func shouldIgnoreWindow(conn *xgb.Conn, win xproto.Window) bool {
 	return false
 }
 
-func (wm *WindowManager) isAbove(w xproto.Window) {
-	fmt.Println(wm.atoms)
-	stateAtom, ok := wm.atoms["_NET_WM_STATE"]
-	if ok {
-		stateAboveAtom, ok := wm.atoms["_NET_WM_STATE_ABOVE"]
-		if ok {
-			// Get property
-			prop, err := xproto.GetProperty(wm.conn, false, w, stateAtom,
-				xproto.AtomAtom, 0, 1024).Reply()
-			if err != nil {
-				slog.Error("Error getting _NET_WM_STATE", "error:", err)
-				return
-			}
-
-			// Iterate through atoms in the property
-			for i := 0; i+4 <= len(prop.Value); i += 4 {
-				atom := xproto.Atom(uint32(prop.Value[i]) |
-					uint32(prop.Value[i+1])<<8 |
-					uint32(prop.Value[i+2])<<16 |
-					uint32(prop.Value[i+3])<<24)
-
-				if atom == stateAboveAtom {
-					xproto.ConfigureWindow(
-						wm.conn,
-						w,
-						xproto.ConfigWindowStackMode,
-						[]uint32{xproto.StackModeAbove},
-					)
-					break
-				}
-			}
-		}
+func (wm *WindowManager) onMapRequest(event xproto.MapRequestEvent) {
+	// a minimized window mapping itself again wants to be restored (ICCCM Iconic -> Normal)
+	if win, ok := wm.windows[event.Window]; ok && win.Minimized {
+		wm.restore(event.Window)
+		return
 	}
-}
 
-func (wm *WindowManager) onMapRequest(event xproto.MapRequestEvent) {
 	// if there is a window to be ignored then we just map it but don't handle it
 	if shouldIgnoreWindow(wm.conn, event.Window) {
 		fmt.Println("ignored window since it is either dock, splash, dialog or notify")
@@ -2656,6 +5312,9 @@ func (wm *WindowManager) onMapRequest(event xproto.MapRequestEvent) {
 		if err != nil {
 			slog.Error("Couldn't create new window id", "error:", err.Error())
 		}
+		if wm.isDock(event.Window) {
+			wm.addDock(event.Window)
+		}
 		return
 	}
 
@@ -2666,6 +5325,19 @@ func (wm *WindowManager) onMapRequest(event xproto.MapRequestEvent) {
 	}
 
 	wm.setWindowDesktop(event.Window, uint32(wm.currMonitor.workspaceIndex))
+
+	// honour any states the window asked for before it was mapped
+	win, ok := wm.windows[event.Window]
+	if !ok {
+		return
+	}
+	if wm.adoptNetWMState(event.Window) && wm.config.AutoFullscreen {
+		wm.fullscreen(win, event.Window)
+	}
+	if win.Sticky {
+		wm.setWindowDesktop(event.Window, allDesktops)
+	}
+	wm.raise(event.Window)
 }
 
 func (wm *WindowManager) frame(w xproto.Window, createdBeforeWM bool) {
@@ -2692,8 +5364,6 @@ func (wm *WindowManager) frame(w xproto.Window, createdBeforeWM bool) {
 		return
 	}
 
-	wm.isAbove(w)
-
 	// skips
 	if attribs.OverrideRedirect {
 		fmt.Println("Skipping override-redirect window", w)
@@ -2770,19 +5440,16 @@ func (wm *WindowManager) frame(w xproto.Window, createdBeforeWM bool) {
 	}
 
 	err = xproto.ChangeWindowAttributesChecked(wm.conn, w, xproto.CwEventMask, []uint32{
-		xproto.EventMaskEnterWindow | xproto.EventMaskLeaveWindow,
+		xproto.EventMaskEnterWindow | xproto.EventMaskLeaveWindow | xproto.EventMaskPropertyChange,
 	}).Check()
 	if err != nil {
 		slog.Error("Failed to set event mask on window", "error:", err)
 	}
 
 	setFrameWindowType(wm.conn, w)
-
-	wins, err := xproto.QueryTree(wm.conn, wm.root).Reply()
-	if err == nil {
-		for _, win := range wins.Children {
-			wm.isAbove(win)
-		}
+	wm.setWMState(w, wmStateNormal)
+	if wm.config.FocusMode == "click" {
+		wm.grabClickToFocus(w)
 	}
 
 	// add all of this to the current workspace record
@@ -2796,11 +5463,25 @@ func (wm *WindowManager) frame(w xproto.Window, createdBeforeWM bool) {
 		Client:     w,
 	})
 	wm.windows[w] = wm.currMonitor.CurrWorkspace.windowList[len(wm.currMonitor.CurrWorkspace.windowList)-1]
+	wm.clientOrder = append(wm.clientOrder, w)
+	wm.stack = append(wm.stack, w)
+	wm.refreshProperties(wm.windows[w])
 	wm.setNetClientList()
 	fmt.Println("Framed window" + strconv.Itoa(int(w)) + "[" + strconv.Itoa(int(w)) + "]")
 }
 
 func (wm *WindowManager) onConfigureRequest(event xproto.ConfigureRequestEvent) {
+	// managed windows restack through our own stacking order so layers are kept
+	if _, ok := wm.windows[event.Window]; ok && event.ValueMask&xproto.ConfigWindowStackMode != 0 {
+		switch event.StackMode {
+		case xproto.StackModeAbove:
+			wm.raise(event.Window)
+		case xproto.StackModeBelow:
+			wm.lower(event.Window)
+		}
+		event.ValueMask &^= xproto.ConfigWindowStackMode | xproto.ConfigWindowSibling
+	}
+
 	if _, ok := wm.windows[event.Window]; ok {
 		if wm.currMonitor.tiling {
 			return
@@ -2852,6 +5533,307 @@ func createChanges(event xproto.ConfigureRequestEvent) []uint32 {
 	return changes
 }
 
+// nextEvent gives back made up key presses and an event we peeked at before waiting for a new one.
+func (wm *WindowManager) nextEvent() (xgb.Event, error) {
+	if len(wm.pressQueue) > 0 {
+		press := wm.pressQueue[0]
+		wm.pressQueue = wm.pressQueue[1:]
+		wm.queuedBinds = press.binds
+		return press.ev, nil
+	}
+	if wm.peeked != nil {
+		event := wm.peeked
+		wm.peeked = nil
+		return event, nil
+	}
+	return wm.conn.WaitForEvent()
+}
+
+// isAutoRepeat checks if a key release is from the key repeating. A repeating key sends a release and a press with
+// the same time straight after each other, after a round trip the press would already be waiting for us.
+func (wm *WindowManager) isAutoRepeat(ev xproto.KeyReleaseEvent) bool {
+	if wm.peeked != nil {
+		return false
+	}
+	_, _ = xproto.GetInputFocus(wm.conn).Reply()
+	next, err := wm.conn.PollForEvent()
+	if err != nil {
+		slog.Error("Event error", "error:", err.Error())
+	}
+	if next == nil {
+		return false
+	}
+	wm.peeked = next
+	press, ok := next.(xproto.KeyPressEvent)
+	if ok && press.Detail == ev.Detail && press.Time == ev.Time {
+		wm.repeatKey = ev.Detail
+		return true
+	}
+	return false
+}
+
+// releaseKey runs the release keybinds that were pressed with this key.
+func (wm *WindowManager) releaseKey(ev xproto.KeyReleaseEvent) {
+	var held []Keybind
+	var released []Keybind
+	for _, kb := range wm.armed {
+		if xproto.Keycode(kb.Keycode) == ev.Detail {
+			released = append(released, kb)
+		} else {
+			held = append(held, kb)
+		}
+	}
+	wm.armed = held
+	if len(released) > 0 {
+		wm.queueKeybinds(released, xproto.KeyPressEvent(ev))
+	}
+}
+
+// queueKeybinds runs keybinds that weren't pressed on the keyboard, like mousebinds, by making up a key press for
+// them that the event loop handles next.
+func (wm *WindowManager) queueKeybinds(binds []Keybind, ev xproto.KeyPressEvent) {
+	state := wm.keybindState(ev.State)
+	for i := range binds {
+		// made to match the made up press so they run like a plain keybind for it
+		binds[i].Keycode, binds[i].Modifiers, binds[i].Then, binds[i].On = uint32(ev.Detail), state, nil, ""
+	}
+	wm.pressQueue = append(wm.pressQueue, queuedPress{binds: binds, ev: ev})
+}
+
+// arg is one of a keybind's args, or def when it isn't set.
+func (kb Keybind) arg(name string, def int) int {
+	if v, ok := kb.Args[name]; ok {
+		return v
+	}
+	return def
+}
+
+// amount is the keybind's amount arg, or def, kept between 0 and limit so it can't wrap around when converted.
+func (kb Keybind) amount(def, limit int) int {
+	return min(max(kb.arg("amount", def), 0), limit)
+}
+
+// gotoWorkspace switches the current monitor to a workspace, taking w along with it if it is set.
+func (wm *WindowManager) gotoWorkspace(workspace int, w xproto.Window) {
+	if workspace < 0 || workspace >= len(wm.currMonitor.Workspaces) {
+		return
+	}
+	// if we want to move the window to the other workspace, delete it from the record of the current workspace so when
+	// they unmap all the other windows (giving the illusion of changing workspace) this one stays then afterwards
+	// reparent it to the workspace that has been changed to
+	window, ok := wm.windows[w]
+	if ok {
+		fmt.Println("moving window")
+		wm.raise(w)
+		remove(&wm.currMonitor.CurrWorkspace.windowList, w)
+	}
+	wm.switchWorkspace(workspace)
+	if ok {
+		wm.currMonitor.CurrWorkspace.windowList = append(wm.currMonitor.CurrWorkspace.windowList, window)
+		wm.setWindowDesktop(w, uint32(wm.currMonitor.workspaceIndex))
+		if window.Urgent {
+			wm.broadcastUrgency()
+		}
+	}
+	wm.fitToLayout()
+}
+
+// queuedPress is a made up key press and the keybinds it runs.
+type queuedPress struct {
+	binds []Keybind
+	ev    xproto.KeyPressEvent
+}
+
+// pendingChord is a keybind sequence part way through, binds are the sequences still possible and depth is how many
+// keys after the prefix have been pressed.
+type pendingChord struct {
+	binds  []Keybind
+	depth  int
+	serial uint32
+}
+
+// startChord grabs the keyboard after the prefix of one or more sequences so we get the key that comes next.
+func (wm *WindowManager) startChord(binds []Keybind) {
+	grab, err := xproto.GrabKeyboard(
+		wm.conn,
+		false,
+		wm.root,
+		xproto.TimeCurrentTime,
+		xproto.GrabModeAsync,
+		xproto.GrabModeAsync,
+	).Reply()
+	if err != nil || grab.Status != xproto.GrabStatusSuccess {
+		slog.Error("Couldn't grab keyboard for keybind sequence", "error:", err)
+		return
+	}
+	wm.chord = &pendingChord{binds: binds}
+	wm.armChordTimeout()
+}
+
+// continueChord takes the next key of a sequence, giving back the keybind once a sequence is finished. A key that
+// doesn't carry on any sequence gives up on them.
+func (wm *WindowManager) continueChord(ev xproto.KeyPressEvent) (Keybind, bool) {
+	// modifiers are pressed on the way to the actual key
+	if wm.isModifierKey(ev.Detail) {
+		return Keybind{}, false
+	}
+
+	c := wm.chord
+	state := wm.keybindState(ev.State)
+	var next []Keybind
+	for _, kb := range c.binds {
+		chord := kb.Then[c.depth]
+		if xproto.Keycode(chord.Keycode) != ev.Detail || chord.Modifiers != state {
+			continue
+		}
+		if len(kb.Then) == c.depth+1 {
+			wm.cancelChord()
+			return kb, true
+		}
+		next = append(next, kb)
+	}
+	if len(next) == 0 {
+		wm.cancelChord()
+		return Keybind{}, false
+	}
+
+	c.binds = next
+	c.depth++
+	wm.armChordTimeout()
+	return Keybind{}, false
+}
+
+func (wm *WindowManager) cancelChord() {
+	xproto.UngrabKeyboard(wm.conn, xproto.TimeCurrentTime)
+	wm.chord = nil
+}
+
+// armChordTimeout (re)starts the wait for the next key of a sequence. The timer can't touch the wm from its own
+// goroutine, so it sends us a client message and the event loop gives up on the sequence if it is still the same one.
+func (wm *WindowManager) armChordTimeout() {
+	wm.chordSerial++
+	wm.chord.serial = wm.chordSerial
+	serial := wm.chordSerial
+	time.AfterFunc(time.Duration(wm.config.ChordTimeout)*time.Millisecond, func() {
+		ev := xproto.ClientMessageEvent{
+			Format: 32,
+			Window: wm.checkWin,
+			Type:   wm.atoms["_DOWM_CHORD_TIMEOUT"],
+			Data:   xproto.ClientMessageDataUnionData32New([]uint32{serial, 0, 0, 0, 0}),
+		}
+		xproto.SendEvent(wm.conn, false, wm.checkWin, xproto.EventMaskNoEvent, string(ev.Bytes()))
+	})
+}
+
+func (wm *WindowManager) isModifierKey(code xproto.Keycode) bool {
+	modMap, err := xproto.GetModifierMapping(wm.conn).Reply()
+	if err != nil {
+		return false
+	}
+	for _, kc := range modMap.Keycodes {
+		if kc == code && kc != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// enterMode swaps the grabbed keys for a binding mode's keybinds, "default" goes back to the normal ones.
+func (wm *WindowManager) enterMode(name string) {
+	if name == "default" {
+		wm.exitMode()
+		return
+	}
+
+	var mode *Mode
+	for i := range wm.config.Modes {
+		if wm.config.Modes[i].Name == name {
+			mode = &wm.config.Modes[i]
+		}
+	}
+	if mode == nil {
+		slog.Error("No such binding mode", "mode", name)
+		return
+	}
+
+	xproto.UngrabKey(wm.conn, xproto.GrabAny, wm.root, xproto.ModMaskAny)
+	wm.mode = name
+	wm.modeKeybinds = nil
+	escape := false
+	for _, kb := range mode.Keybinds {
+		kb = wm.createKeybind(&kb, 0)
+		wm.modeKeybinds = append(wm.modeKeybinds, kb)
+		if kb.Key == "Escape" || kb.Key == "escape" {
+			escape = true
+		}
+	}
+	// there always has to be a way out
+	if !escape {
+		wm.modeKeybinds = append(wm.modeKeybinds, wm.createKeybind(&Keybind{Key: "Escape", Mode: "default"}, 0))
+	}
+	wm.broadcastMode()
+}
+
+// remapKeys reads the keyboard mapping again and regrabs every keybind, keycodes come from the key names so they
+// follow the new layout.
+func (wm *WindowManager) remapKeys() {
+	keyMap, modMap := keybind.MapsGet(XUtil)
+	keybind.KeyMapSet(XUtil, keyMap)
+	keybind.ModMapSet(XUtil, modMap)
+
+	// anything half pressed was pressed on the old keycodes
+	if wm.chord != nil {
+		wm.cancelChord()
+	}
+	wm.armed = nil
+
+	xproto.UngrabKey(wm.conn, xproto.GrabAny, wm.root, xproto.ModMaskAny)
+	for i, kb := range wm.config.Keybinds {
+		wm.config.Keybinds[i] = wm.createKeybind(&kb, wm.mod)
+	}
+	// the config keybinds were grabbed to work out their keycodes, entering the mode again swaps them for its own
+	if mode := wm.mode; mode != "" {
+		wm.mode = ""
+		wm.enterMode(mode)
+	}
+	// num lock might be on another modifier now
+	wm.grabMousebinds()
+}
+
+func (wm *WindowManager) exitMode() {
+	if wm.mode == "" {
+		return
+	}
+	xproto.UngrabKey(wm.conn, xproto.GrabAny, wm.root, xproto.ModMaskAny)
+	wm.mode = ""
+	wm.modeKeybinds = nil
+	for _, kb := range wm.config.Keybinds {
+		wm.createKeybind(&kb, wm.mod)
+	}
+	wm.broadcastMode()
+}
+
+// broadcastMode sets _DOWM_MODE on the root window to the name of the active binding mode so bars can show it.
+func (wm *WindowManager) broadcastMode() {
+	mode := wm.mode
+	if mode == "" {
+		mode = "default"
+	}
+	err := xproto.ChangePropertyChecked(
+		wm.conn,
+		xproto.PropModeReplace,
+		wm.root,
+		wm.atoms["_DOWM_MODE"],
+		wm.atoms["UTF8_STRING"],
+		8,
+		uint32(len(mode)),
+		[]byte(mode),
+	).Check()
+	if err != nil {
+		slog.Error("Couldn't set _DOWM_MODE", "error:", err)
+	}
+}
+
 // Close closes the window manager.
 func (wm *WindowManager) Close() {
 	// close the connection
@@ -2861,28 +5843,18 @@ func (wm *WindowManager) Close() {
 }
 
 // The end.
+// setKeyBinds adds the workspace keybinds, the nth key in workspace-keys switches to workspace n and with shift it
+// takes the focused window along.
 func (wm *WindowManager) setKeyBinds() {
-	// workspace keybinds, ik not very idiomatic but its fine :)
-	wm.config.Keybinds = append(wm.config.Keybinds, []Keybind{
-		wm.createKeybind(&Keybind{Key: "0", Shift: false, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "1", Shift: false, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "2", Shift: false, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "3", Shift: false, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "4", Shift: false, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "5", Shift: false, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "6", Shift: false, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "7", Shift: false, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "8", Shift: false, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "9", Shift: false, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "0", Shift: true, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "1", Shift: true, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "2", Shift: true, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "3", Shift: true, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "4", Shift: true, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "5", Shift: true, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "6", Shift: true, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "7", Shift: true, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "8", Shift: true, Keycode: 0}),
-		wm.createKeybind(&Keybind{Key: "9", Shift: true, Keycode: 0}),
-	}...)
+	for i, key := range wm.config.WorkspaceKeys {
+		if i >= 10 {
+			slog.Error("Too many workspace keys, there are only 10 workspaces", "key", key)
+			break
+		}
+		args := map[string]int{"index": i + 1}
+		wm.config.Keybinds = append(wm.config.Keybinds,
+			wm.createKeybind(&Keybind{Key: key, Role: "workspace", Args: args}, wm.mod),
+			wm.createKeybind(&Keybind{Key: key, Shift: true, Role: "move-to-workspace", Args: args}, wm.mod),
+		)
+	}
 }